@@ -0,0 +1,254 @@
+package jeen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Builder composes a named query from parts, e.g. for optional filters
+// and user selected sorting:
+//
+//	q := res.Database.Select("id", "name").From("users").
+//		Sortable("id", "name", "created_at").
+//		OrderBy(res.Request.QueryParam("sort"))
+//	if name := res.Request.QueryParam("name"); name != "" {
+//		q.Where("name LIKE :name", jeen.Map{"name": name + "%"})
+//	}
+//	err := q.Limit(20).Query().Result(&users)
+//
+// Select, From, Join, Where, GroupBy and Having are written as is and must
+// not contain user input except through named parameters. OrderBy only
+// accepts column names, see Sortable.
+type Builder struct {
+	db       *Database
+	columns  []string
+	from     string
+	joins    []string
+	where    []string
+	groupBy  []string
+	having   []string
+	orderBy  []string
+	sortable map[string]bool
+	limit    int
+	offset   int
+	args     []interface{}
+	err      error
+}
+
+// Select starts a query builder on the database with the selected
+// columns, default is *
+func (d *Database) Select(columns ...string) *Builder {
+	return &Builder{
+		db:      d,
+		columns: columns,
+	}
+}
+
+// From sets the table of the query
+func (b *Builder) From(table string) *Builder {
+	b.from = table
+	return b
+}
+
+// Join adds a join clause, e.g. "LEFT JOIN roles r ON r.id = u.role_id"
+func (b *Builder) Join(join string, args ...interface{}) *Builder {
+	b.joins = append(b.joins, join)
+	b.args = append(b.args, args...)
+	return b
+}
+
+// Where adds a condition with named parameters of args, multiple
+// conditions are joined with AND. Parameter names must be unique in
+// the whole query.
+func (b *Builder) Where(cond string, args ...interface{}) *Builder {
+	b.where = append(b.where, cond)
+	b.args = append(b.args, args...)
+	return b
+}
+
+// GroupBy adds group by expressions
+func (b *Builder) GroupBy(columns ...string) *Builder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// Having adds a having condition, see Where
+func (b *Builder) Having(cond string, args ...interface{}) *Builder {
+	b.having = append(b.having, cond)
+	b.args = append(b.args, args...)
+	return b
+}
+
+// Sortable sets the columns allowed by OrderBy, it must be called before
+// OrderBy so columns that are not meant to be sorted (e.g. password_hash)
+// can't be used to leak their order
+func (b *Builder) Sortable(columns ...string) *Builder {
+	b.sortable = make(map[string]bool, len(columns))
+	for _, column := range columns {
+		b.sortable[column] = true
+	}
+	return b
+}
+
+// OrderBy adds sorting, each sort is a column with optional direction:
+// "name", "name desc" or "-name" for descending. Multiple sorts can be
+// separated by comma, so it can be taken from the request directly.
+// Empty sort is ignored, invalid column or direction and OrderBy without
+// Sortable make the query fail with an error.
+func (b *Builder) OrderBy(sorts ...string) *Builder {
+	if b.sortable == nil {
+		b.setErr(errors.New("OrderBy needs Sortable columns"))
+		return b
+	}
+	for _, sort := range sorts {
+		for _, term := range strings.Split(sort, ",") {
+			term = strings.TrimSpace(term)
+			if term == "" {
+				continue
+			}
+
+			dir := "ASC"
+			if strings.HasPrefix(term, "-") {
+				dir, term = "DESC", term[1:]
+			}
+
+			fields := strings.Fields(term)
+			switch {
+			case len(fields) == 2 && dir == "ASC" &&
+				(strings.EqualFold(fields[1], "asc") || strings.EqualFold(fields[1], "desc")):
+				dir = strings.ToUpper(fields[1])
+			case len(fields) != 1:
+				b.setErr(fmt.Errorf(`invalid sort '%s'`, term))
+				continue
+			}
+
+			column := fields[0]
+			if !b.sortable[column] || !identifier.MatchString(column) {
+				b.setErr(fmt.Errorf(`invalid sort column '%s'`, column))
+				continue
+			}
+			b.orderBy = append(b.orderBy, column+" "+dir)
+		}
+	}
+	return b
+}
+
+// Limit sets maximum rows returned, 0 is no limit
+func (b *Builder) Limit(limit int) *Builder {
+	b.limit = limit
+	return b
+}
+
+// Offset sets rows skipped before returning rows
+func (b *Builder) Offset(offset int) *Builder {
+	b.offset = offset
+	return b
+}
+
+// setErr keeps the first error
+func (b *Builder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Build returns the named query and its arguments, to be used with
+// Database.Query or BuildQuery
+func (b *Builder) Build() (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if b.from == "" {
+		return "", nil, fmt.Errorf("query builder has no table")
+	}
+	if b.limit < 0 || b.offset < 0 {
+		return "", nil, fmt.Errorf("invalid limit %d or offset %d", b.limit, b.offset)
+	}
+
+	var q strings.Builder
+	q.WriteString("SELECT ")
+	if len(b.columns) == 0 {
+		q.WriteString("*")
+	} else {
+		q.WriteString(strings.Join(b.columns, ", "))
+	}
+	q.WriteString(" FROM ")
+	q.WriteString(b.from)
+	for _, join := range b.joins {
+		q.WriteString(" ")
+		q.WriteString(join)
+	}
+	writeConditions(&q, " WHERE ", b.where)
+	if len(b.groupBy) > 0 {
+		q.WriteString(" GROUP BY ")
+		q.WriteString(strings.Join(b.groupBy, ", "))
+	}
+	writeConditions(&q, " HAVING ", b.having)
+
+	orderBy := b.orderBy
+	// sql server requires ORDER BY for OFFSET
+	if len(orderBy) == 0 && b.db.bindtype == AT && (b.limit > 0 || b.offset > 0) {
+		orderBy = []string{"(SELECT NULL)"}
+	}
+	if len(orderBy) > 0 {
+		q.WriteString(" ORDER BY ")
+		q.WriteString(strings.Join(orderBy, ", "))
+	}
+
+	writeLimit(&q, b.db.bindtype, b.limit, b.offset)
+	return q.String(), b.args, nil
+}
+
+// writeLimit write limit and offset in the syntax of the database
+func writeLimit(q *strings.Builder, bindtype int, limit int, offset int) {
+	switch bindtype {
+	case AT, NAMED:
+		if limit > 0 || offset > 0 {
+			q.WriteString(" OFFSET " + strconv.Itoa(offset) + " ROWS")
+		}
+		if limit > 0 {
+			q.WriteString(" FETCH NEXT " + strconv.Itoa(limit) + " ROWS ONLY")
+		}
+	default:
+		if limit > 0 {
+			q.WriteString(" LIMIT " + strconv.Itoa(limit))
+		} else if offset > 0 && bindtype == QUESTION {
+			// mysql and sqlite only accept OFFSET after LIMIT
+			q.WriteString(" LIMIT 9223372036854775807")
+		}
+		if offset > 0 {
+			q.WriteString(" OFFSET " + strconv.Itoa(offset))
+		}
+	}
+}
+
+// writeConditions write conditions joined with AND
+func writeConditions(q *strings.Builder, keyword string, conds []string) {
+	if len(conds) == 0 {
+		return
+	}
+	q.WriteString(keyword)
+	for i, cond := range conds {
+		if i > 0 {
+			q.WriteString(" AND ")
+		}
+		if len(conds) > 1 {
+			cond = "(" + cond + ")"
+		}
+		q.WriteString(cond)
+	}
+}
+
+// Query builds the query, error from the builder is returned when the
+// query is executed, see SqlQuery.Err
+func (b *Builder) Query() *SqlQuery {
+	query, args, err := b.Build()
+	if err != nil {
+		q := b.db.Query("")
+		q.err = err
+		return q
+	}
+	return b.db.Query(query, args...)
+}
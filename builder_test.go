@@ -0,0 +1,70 @@
+package jeen
+
+import "testing"
+
+func TestBuilderOrderBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		sortable []string
+		sort     string
+		query    string
+		err      string
+	}{
+		{
+			name:     "sortable",
+			sortable: []string{"name", "id"},
+			sort:     "-name, id",
+			query:    "SELECT * FROM users ORDER BY name DESC, id ASC",
+		},
+		{
+			name:     "direction",
+			sortable: []string{"name"},
+			sort:     "name desc",
+			query:    "SELECT * FROM users ORDER BY name DESC",
+		},
+		{
+			name:     "empty",
+			sortable: []string{"name"},
+			query:    "SELECT * FROM users",
+		},
+		{
+			name: "without sortable",
+			sort: "password_hash",
+			err:  "OrderBy needs Sortable columns",
+		},
+		{
+			name:     "not sortable",
+			sortable: []string{"name"},
+			sort:     "password_hash",
+			err:      "invalid sort column 'password_hash'",
+		},
+		{
+			name:     "injection",
+			sortable: []string{"name"},
+			sort:     "name; DROP TABLE users",
+			err:      "invalid sort 'name; DROP TABLE users'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := (&Database{bindtype: DOLLAR}).Select().From("users")
+			if tt.sortable != nil {
+				b.Sortable(tt.sortable...)
+			}
+			query, _, err := b.OrderBy(tt.sort).Build()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.query {
+				t.Errorf("query = %q, want %q", query, tt.query)
+			}
+		})
+	}
+}
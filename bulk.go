@@ -0,0 +1,368 @@
+package jeen
+
+import (
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valid table or column name, optionally qualified with schema
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// bulkRows are the columns and values of Insert and Upsert rows
+type bulkRows struct {
+	columns []string
+	values  [][]interface{}
+}
+
+// Insert inserts rows into table with multi-row statements, rows is a
+// slice of structs, pointers to struct or Maps. Columns are taken from the
+// `jeen` tag like in scanning, fields with `readonly` tag option (e.g. an
+// auto increment id) are skipped:
+//
+//	type User struct {
+//		ID   int    `jeen:"id,readonly"`
+//		Name string `jeen:"name"`
+//	}
+//
+//	n, err := res.Database.Insert("users", []User{{Name: "a"}, {Name: "b"}})
+//
+// Rows are split into batches under the parameter limit of the database,
+// and all batches run in one transaction. It returns the rows affected.
+func (d *Database) Insert(table string, rows interface{}) (int64, error) {
+	return d.bulk(table, rows, nil)
+}
+
+// Upsert inserts rows or updates every other column when a row with the
+// same conflictKeys exists, see Insert. The statement depends on the bind
+// type: ON CONFLICT for postgres and sqlite, ON DUPLICATE KEY UPDATE for
+// mysql (conflictKeys only used to exclude them from update) and MERGE for
+// sql server and oracle.
+func (d *Database) Upsert(table string, rows interface{}, conflictKeys ...string) (int64, error) {
+	if len(conflictKeys) == 0 {
+		return 0, errors.New("upsert needs at least one conflict key")
+	}
+	return d.bulk(table, rows, conflictKeys)
+}
+
+// bulk insert or upsert rows in batches
+func (d *Database) bulk(table string, rows interface{}, conflictKeys []string) (int64, error) {
+	data, err := newBulkRows(rows)
+	if err != nil {
+		return 0, err
+	}
+	if len(data.values) == 0 {
+		return 0, nil
+	}
+
+	for _, name := range append(append([]string{table}, data.columns...), conflictKeys...) {
+		if !identifier.MatchString(name) {
+			return 0, fmt.Errorf(`invalid identifier '%s'`, name)
+		}
+	}
+	for _, key := range conflictKeys {
+		if indexOf(data.columns, key) < 0 {
+			return 0, fmt.Errorf(`conflict key '%s' is not a column`, key)
+		}
+	}
+
+	size := d.batchSize(len(data.columns))
+	var affected int64
+
+	run := func(db *Database) error {
+		for start := 0; start < len(data.values); start += size {
+			end := start + size
+			if end > len(data.values) {
+				end = len(data.values)
+			}
+
+			query, args := db.bulkQuery(table, data.columns, data.values[start:end], conflictKeys)
+			result, err := db.Query(query, args).Exec()
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err == nil {
+				affected += n
+			}
+		}
+		return nil
+	}
+
+	if len(data.values) <= size {
+		return affected, run(d)
+	}
+	return affected, d.Tx(run)
+}
+
+// batchSize returns maximum rows per statement under the parameter
+// limit of the database
+func (d *Database) batchSize(columns int) int {
+	maxParams, maxRows := 65535, 0
+	switch d.bindtype {
+	case QUESTION:
+		if strings.Contains(d.drivername, "sqlite") {
+			maxParams = 999
+		}
+	case AT:
+		maxParams, maxRows = 2000, 1000
+	case NAMED:
+		maxParams, maxRows = 1000, 1000
+	}
+
+	size := maxParams / columns
+	if maxRows > 0 && size > maxRows {
+		size = maxRows
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// bulkQuery build named query of one batch, parameters are named
+// r<row>.<column> so QueryLogger.Redact matches them by column
+func (d *Database) bulkQuery(table string, columns []string, rows [][]interface{}, conflictKeys []string) (string, Map) {
+	args := Map{}
+	params := make([][]string, len(rows))
+	for r, row := range rows {
+		params[r] = make([]string, len(columns))
+		for c, value := range row {
+			// $ is not allowed in parameter names
+			name := "r" + strconv.Itoa(r) + "." + strings.ReplaceAll(columns[c], "$", "_")
+			if _, ok := args[name]; ok {
+				name += "_" + strconv.Itoa(c)
+			}
+			params[r][c] = ":" + name
+			// never expand slice, it is a column value
+			args[name] = Array(value)
+		}
+	}
+
+	var updates []string
+	for _, column := range columns {
+		if indexOf(conflictKeys, column) < 0 {
+			updates = append(updates, column)
+		}
+	}
+
+	cols := strings.Join(columns, ", ")
+	var b strings.Builder
+
+	switch {
+	// oracle has no multi-row VALUES
+	case d.bindtype == NAMED && conflictKeys == nil:
+		b.WriteString("INSERT ALL")
+		for _, row := range params {
+			fmt.Fprintf(&b, " INTO %s (%s) VALUES (%s)", table, cols, strings.Join(row, ", "))
+		}
+		b.WriteString(" SELECT 1 FROM DUAL")
+
+	case conflictKeys == nil:
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES %s", table, cols, valuesList(params))
+
+	case d.bindtype == AT || d.bindtype == NAMED:
+		d.writeMerge(&b, table, columns, params, conflictKeys, updates)
+
+	case d.bindtype == QUESTION && !strings.Contains(d.drivername, "sqlite"):
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE ", table, cols, valuesList(params))
+		if len(updates) == 0 {
+			// no-op update to ignore duplicate
+			updates = conflictKeys[:1]
+		}
+		for i, column := range updates {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s = VALUES(%s)", column, column)
+		}
+
+	default:
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) ", table, cols, valuesList(params),
+			strings.Join(conflictKeys, ", "))
+		if len(updates) == 0 {
+			b.WriteString("DO NOTHING")
+			break
+		}
+		b.WriteString("DO UPDATE SET ")
+		for i, column := range updates {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s = EXCLUDED.%s", column, column)
+		}
+	}
+
+	return b.String(), args
+}
+
+// writeMerge write MERGE statement for sql server and oracle
+func (d *Database) writeMerge(b *strings.Builder, table string, columns []string, params [][]string, conflictKeys []string, updates []string) {
+	if d.bindtype == AT {
+		fmt.Fprintf(b, "MERGE INTO %s WITH (HOLDLOCK) AS target USING (VALUES %s) AS source (%s)",
+			table, valuesList(params), strings.Join(columns, ", "))
+	} else {
+		fmt.Fprintf(b, "MERGE INTO %s target USING (", table)
+		for r, row := range params {
+			if r > 0 {
+				b.WriteString(" UNION ALL ")
+			}
+			b.WriteString("SELECT ")
+			for c, param := range row {
+				if c > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(b, "%s %s", param, columns[c])
+			}
+			b.WriteString(" FROM DUAL")
+		}
+		b.WriteString(") source")
+	}
+
+	b.WriteString(" ON (")
+	for i, key := range conflictKeys {
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		fmt.Fprintf(b, "target.%s = source.%s", key, key)
+	}
+	b.WriteString(")")
+
+	if len(updates) > 0 {
+		b.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+		for i, column := range updates {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(b, "target.%s = source.%s", column, column)
+		}
+	}
+
+	sources := make([]string, len(columns))
+	for i, column := range columns {
+		sources[i] = "source." + column
+	}
+	fmt.Fprintf(b, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+		strings.Join(columns, ", "), strings.Join(sources, ", "))
+
+	// sql server requires MERGE to be terminated
+	if d.bindtype == AT {
+		b.WriteString(";")
+	}
+}
+
+// valuesList returns (a, b), (c, d) of params
+func valuesList(params [][]string) string {
+	rows := make([]string, len(params))
+	for i, row := range params {
+		rows[i] = "(" + strings.Join(row, ", ") + ")"
+	}
+	return strings.Join(rows, ", ")
+}
+
+// newBulkRows read columns and values from slice of structs or Maps
+func newBulkRows(rows interface{}) (*bulkRows, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf(`rows type %T is not supported, use slice of struct or Map`, rows)
+	}
+
+	data := &bulkRows{}
+	var rowType reflect.Type
+	var info *structInfo
+
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+			if row.IsNil() {
+				return nil, fmt.Errorf(`row %d is nil`, i)
+			}
+			row = row.Elem()
+		}
+
+		if i == 0 {
+			rowType = row.Type()
+			switch {
+			case row.Kind() == reflect.Struct:
+				info = structFields(rowType)
+				data.columns = insertColumns(info, rowType)
+			case row.Kind() == reflect.Map && rowType.Key().Kind() == reflect.String:
+				for _, key := range row.MapKeys() {
+					data.columns = append(data.columns, key.String())
+				}
+				sort.Strings(data.columns)
+			default:
+				return nil, fmt.Errorf(`row type %s is not supported, use struct or Map`, rowType)
+			}
+			if len(data.columns) == 0 {
+				return nil, errors.New("rows have no column")
+			}
+		}
+
+		if row.Type() != rowType {
+			return nil, fmt.Errorf(`row %d type %s is different from %s`, i, row.Type(), rowType)
+		}
+
+		values := make([]interface{}, len(data.columns))
+		if info != nil {
+			for c, column := range data.columns {
+				values[c], _ = lookupStruct(row, column)
+			}
+		} else {
+			if row.Len() != len(data.columns) {
+				return nil, fmt.Errorf(`row %d has different columns`, i)
+			}
+			for c, column := range data.columns {
+				value := row.MapIndex(reflect.ValueOf(column).Convert(rowType.Key()))
+				if !value.IsValid() {
+					return nil, fmt.Errorf(`row %d has no column '%s'`, i, column)
+				}
+				values[c] = value.Interface()
+			}
+		}
+		data.values = append(data.values, values)
+	}
+
+	return data, nil
+}
+
+// insertColumns returns struct fields that can be inserted, nested fields
+// and struct values other than time.Time or driver.Valuer are skipped
+func insertColumns(info *structInfo, t reflect.Type) []string {
+	valuer := reflect.TypeOf((*sqldriver.Valuer)(nil)).Elem()
+	timeType := reflect.TypeOf(time.Time{})
+
+	var columns []string
+	for _, name := range info.names {
+		if strings.Contains(name, ".") || info.readonly[name] {
+			continue
+		}
+
+		field := t.FieldByIndex(info.index[name])
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct && fieldType != timeType &&
+			!field.Type.Implements(valuer) && !reflect.PtrTo(fieldType).Implements(valuer) {
+			continue
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+// indexOf returns index of s in list, -1 if not found
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
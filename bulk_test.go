@@ -0,0 +1,154 @@
+package jeen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBulkRedact(t *testing.T) {
+	logger := &QueryLogger{Redact: []string{"password"}}
+	columns := []string{"email", "password"}
+	rows := [][]interface{}{
+		{"a@example.com", "secret-a"},
+		{"b@example.com", "secret-b"},
+	}
+
+	for _, bindtype := range []int{QUESTION, DOLLAR, NAMED, AT} {
+		db := &Database{bindtype: bindtype}
+		named, params := db.bulkQuery("users", columns, rows, nil)
+		_, args, names, err := db.buildQuery(named, []interface{}{params})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := logger.args(&QueryEvent{Args: args, Names: names})
+		want := []interface{}{"a@example.com", "[REDACTED]", "b@example.com", "[REDACTED]"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("bindtype %d: args = %v, want %v", bindtype, got, want)
+		}
+	}
+}
+
+func TestBulkQuery(t *testing.T) {
+	rows := [][]interface{}{{1, "a"}, {2, "b"}}
+
+	tests := []struct {
+		name         string
+		drivername   string
+		columns      []string
+		conflictKeys []string
+		query        string
+	}{
+		{
+			name:       "insert",
+			drivername: "pgx",
+			columns:    []string{"id", "name"},
+			query:      `INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4)`,
+		},
+		{
+			name:         "postgres on conflict",
+			drivername:   "pgx",
+			columns:      []string{"id", "name"},
+			conflictKeys: []string{"id"},
+			query:        `INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name`,
+		},
+		{
+			name:         "sqlite on conflict do nothing",
+			drivername:   "sqlite3",
+			columns:      []string{"id"},
+			conflictKeys: []string{"id"},
+			query:        `INSERT INTO users (id) VALUES (?), (?) ON CONFLICT (id) DO NOTHING`,
+		},
+		{
+			name:         "mysql on duplicate key",
+			drivername:   "mysql",
+			columns:      []string{"id", "name"},
+			conflictKeys: []string{"id"},
+			query:        `INSERT INTO users (id, name) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE name = VALUES(name)`,
+		},
+		{
+			name:         "mysql on duplicate key without update",
+			drivername:   "mysql",
+			columns:      []string{"id"},
+			conflictKeys: []string{"id"},
+			query:        `INSERT INTO users (id) VALUES (?), (?) ON DUPLICATE KEY UPDATE id = VALUES(id)`,
+		},
+		{
+			name:         "sql server merge",
+			drivername:   "sqlserver",
+			columns:      []string{"id", "name"},
+			conflictKeys: []string{"id"},
+			query: `MERGE INTO users WITH (HOLDLOCK) AS target USING (VALUES (@p1, @p2), (@p3, @p4)) AS source (id, name)` +
+				` ON (target.id = source.id) WHEN MATCHED THEN UPDATE SET target.name = source.name` +
+				` WHEN NOT MATCHED THEN INSERT (id, name) VALUES (source.id, source.name);`,
+		},
+		{
+			name:       "oracle insert all",
+			drivername: "godror",
+			columns:    []string{"id", "name"},
+			query: `INSERT ALL INTO users (id, name) VALUES (:r0_id, :r0_name)` +
+				` INTO users (id, name) VALUES (:r1_id, :r1_name) SELECT 1 FROM DUAL`,
+		},
+		{
+			name:         "oracle merge",
+			drivername:   "godror",
+			columns:      []string{"id", "name"},
+			conflictKeys: []string{"id"},
+			query: `MERGE INTO users target USING (SELECT :r0_id id, :r0_name name FROM DUAL` +
+				` UNION ALL SELECT :r1_id id, :r1_name name FROM DUAL) source ON (target.id = source.id)` +
+				` WHEN MATCHED THEN UPDATE SET target.name = source.name` +
+				` WHEN NOT MATCHED THEN INSERT (id, name) VALUES (source.id, source.name)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &Database{bindtype: BindType(tt.drivername), drivername: tt.drivername}
+			values := make([][]interface{}, len(rows))
+			for i, row := range rows {
+				values[i] = row[:len(tt.columns)]
+			}
+
+			named, params := db.bulkQuery("users", tt.columns, values, tt.conflictKeys)
+			query, args, _, err := db.buildQuery(named, []interface{}{params})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.query {
+				t.Errorf("query = %s\nwant %s", query, tt.query)
+			}
+
+			var want []interface{}
+			for _, row := range values {
+				want = append(want, row...)
+			}
+			if !reflect.DeepEqual(args, want) {
+				t.Errorf("args = %v, want %v", args, want)
+			}
+		})
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		drivername string
+		columns    int
+		want       int
+	}{
+		{"pgx", 2, 32767},
+		{"pgx", 70000, 1},
+		{"mysql", 2, 32767},
+		{"sqlite3", 2, 499},
+		{"sqlserver", 1, 1000},
+		{"sqlserver", 3, 666},
+		{"godror", 1, 1000},
+		{"godror", 3, 333},
+	}
+
+	for _, tt := range tests {
+		db := &Database{bindtype: BindType(tt.drivername), drivername: tt.drivername}
+		if got := db.batchSize(tt.columns); got != tt.want {
+			t.Errorf("batchSize(%d) of %s = %d, want %d", tt.columns, tt.drivername, got, tt.want)
+		}
+	}
+}
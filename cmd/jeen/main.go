@@ -0,0 +1,60 @@
+// Command jeen is the command line tool of jeen.
+//
+//	jeen migrate [flags] up [N] | down [N|all] | status | create NAME
+//
+// The command only includes the pgx driver, for other databases call
+// migrate.Run from the application with its own driver.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fuadarradhi/jeen"
+	"github.com/fuadarradhi/jeen/migrate"
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "migrate" {
+		fmt.Fprintln(os.Stderr, "Usage: jeen migrate [flags] <command> [arguments]")
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := flags.String("dir", "migrations", "migrations directory")
+	driver := flags.String("driver", "pgx", "database/sql driver name")
+	dsn := flags.String("dsn", os.Getenv("DATABASE_URL"), "data source name, default $DATABASE_URL")
+	table := flags.String("table", migrate.DefaultTable, "table to track applied versions")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: jeen migrate [flags] <command> [arguments]")
+		flags.PrintDefaults()
+		fmt.Fprintln(flags.Output(), "\n"+migrate.Usage)
+	}
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+
+	var db *sql.DB
+	if len(args) > 0 && args[0] != "create" {
+		var err error
+		db, err = sql.Open(*driver, *dsn)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer db.Close()
+	}
+
+	err := migrate.Run(context.Background(), db, jeen.BindType(*driver), *dir, args, os.Stdout,
+		migrate.WithTable(*table))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if db != nil {
+			db.Close()
+		}
+		os.Exit(1)
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	sqldriver "database/sql/driver"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
-	"unicode"
-	"unicode/utf8"
 
 	"github.com/georgysavva/scany/dbscan"
 	"github.com/georgysavva/scany/sqlscan"
@@ -23,19 +25,98 @@ const (
 	AT
 )
 
+// name of the database registered from Driver.Database
+const DefaultDatabase = "default"
+
+// database/sql DB pool with the bind type detected from its driver name
+type pool struct {
+	db         *sql.DB
+	bindtype   int
+	drivername string
+
+	// read replicas, nil if not configured
+	replicas *replicas
+
+	// database name and query hooks
+	name  string
+	hooks []QueryHook
+
+	// prepared statement cache, nil if disabled
+	stmts *stmtCache
+}
+
+// create new pool and detect bind type from driver name
+func newPool(db *sql.DB, drivername string) *pool {
+	return &pool{
+		db:         db,
+		bindtype:   BindType(drivername),
+		drivername: drivername,
+	}
+}
+
+// BindType returns the bind type of database/sql driver name,
+// UNKNOWN if the driver is not known
+func BindType(drivername string) int {
+	defaultBinds := map[int][]string{
+		DOLLAR:   {"postgres", "pgx", "pq-timeouts", "cloudsqlpostgres", "ql", "nrpostgres", "cockroach"},
+		QUESTION: {"mysql", "sqlite3", "nrmysql", "nrsqlite3"},
+		NAMED:    {"oci8", "ora", "goracle", "godror"},
+		AT:       {"sqlserver"},
+	}
+
+	bindtype := UNKNOWN
+	for bind, drivers := range defaultBinds {
+		for _, driver := range drivers {
+			if driver == drivername {
+				bindtype = bind
+				break
+			}
+		}
+		if bindtype != UNKNOWN {
+			break
+		}
+	}
+	return bindtype
+}
+
 type Database struct {
 	// request context
 	context context.Context
 
+	// bind type detected from the driver name of the owning server
+	bindtype   int
+	drivername string
+
+	// read replicas of the pool, nil if not configured
+	replicas *replicas
+
+	// database name and query hooks, see QueryHook
+	name  string
+	hooks []QueryHook
+
+	// prepared statement cache of the pool, nil if disabled
+	stmts *stmtCache
+
 	// scanny db scan
 	scan *dbscan.API
 
 	// database/sql DB pool, can be used by other packages that require a *sql.DB
 	DB *sql.DB
 
-	// database/sql Conn, can be used by other packages that require
-	// a single connection from *sql.DB
-	Conn *sql.Conn
+	// connection acquired on first use, shared with Tx
+	lazy *lazyConn
+
+	// active transaction, nil if not inside Tx
+	tx *sql.Tx
+
+	// nested Tx depth, used to name savepoints
+	depth int
+}
+
+// executor is implemented by both *sql.Conn and *sql.Tx
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
 type SqlQuery struct {
@@ -45,162 +126,403 @@ type SqlQuery struct {
 	// scanny scan
 	scan *dbscan.API
 
-	// conn from sql.DB
-	conn *sql.Conn
+	// database that runs the query, the connection or transaction
+	// is resolved on execution
+	db *Database
+
+	// read replicas, nil inside Tx
+	replicas *replicas
+
+	// force read query on primary, see OnPrimary
+	primary bool
+
+	// skip prepared statement cache, see Unprepared
+	unprepared bool
 
 	// save query before get result or scan to struct
 	query string
 
 	// save args before get result or scan to struct
 	args []interface{}
+
+	// named parameter of each argument, for QueryEvent
+	names []string
+
+	// database name and query hooks, see QueryHook
+	database string
+	hooks    []QueryHook
+
+	// error from BuildQuery, returned by Result, Row and Exec
+	err error
+
+	// result columns of Maps and Map
+	columns []Column
 }
 
-// Conn returns a single connection by either opening a new connection
-// or returning an existing connection from the connection pool. Conn will
-// block until either a connection is returned or ctx is canceled.
-// Queries run on the same Conn will be run in the same database session.
-//
-// Every Conn must be returned to the database pool after use by
-// calling Database.Close.
-func conn(ctx context.Context, db *sql.DB) (*Database, error) {
-	conn, err := db.Conn(ctx)
+// MissingParamError is returned when a named parameter in the query
+// is not defined in the arguments
+type MissingParamError struct {
+	Name string
+}
+
+func (e *MissingParamError) Error() string {
+	return fmt.Sprintf(`field '%s' is not defined`, e.Name)
+}
+
+// UnusedParamError is returned when arguments are not used by any
+// named parameter in the query
+type UnusedParamError struct {
+	Names []string
+}
+
+func (e *UnusedParamError) Error() string {
+	return fmt.Sprintf(`field '%s' is not used`, strings.Join(e.Names, "', '"))
+}
+
+// EmptySliceError is returned when a slice parameter has no element,
+// because it can not be expanded to a valid IN clause
+type EmptySliceError struct {
+	Name string
+}
+
+func (e *EmptySliceError) Error() string {
+	return fmt.Sprintf(`field '%s' is an empty slice`, e.Name)
+}
+
+// ParseError is returned when the query can not be parsed, Pos is the
+// byte offset in the named query
+type ParseError struct {
+	Pos     int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf(`parse error at %d: %s`, e.Pos, e.Message)
+}
+
+// lazyConn acquires a single connection from the pool on first use,
+// so requests that never touch the database don't hold a connection
+type lazyConn struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	pool   *pool
+	ping   time.Duration
+	conn   *sql.Conn
+	closed bool
+
+	// setup runs on the new connection and returns reset that runs before
+	// it is returned to the pool, see Tenants.Schema
+	setup func(ctx context.Context, conn *sql.Conn) (reset func(ctx context.Context) error, err error)
+	reset func(ctx context.Context) error
+
+	// discard the connection instead of returning it to the pool, e.g.
+	// after a failed commit that may leave the transaction open
+	bad bool
+}
+
+// get returns the connection, acquired from the pool on first call.
+// When ping is set, the new connection is checked with PingContext.
+func (l *lazyConn) get() (*sql.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, ErrNoConnection
+	}
+	if l.conn != nil {
+		return l.conn, nil
+	}
+
+	conn, err := l.pool.db.Conn(l.ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// only for ping, timeout context 3 second
-	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
+	if l.ping > 0 {
+		pingCtx, cancel := context.WithTimeout(l.ctx, l.ping)
+		defer cancel()
 
-	err = conn.PingContext(pingCtx)
-	if err != nil {
-		return nil, err
+		if err := conn.PingContext(pingCtx); err != nil {
+			conn.Close()
+			return nil, err
+		}
 	}
 
-	scan, err := sqlscan.NewDBScanAPI(dbscan.WithStructTagKey("jeen"))
+	if l.setup != nil {
+		reset, err := l.setup(l.ctx, conn)
+		if err != nil {
+			discardConn(conn)
+			return nil, err
+		}
+		l.reset = reset
+	}
+
+	l.conn = conn
+	return conn, nil
+}
+
+// markBad discards the connection on close instead of returning it to
+// the pool
+func (l *lazyConn) markBad() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bad = true
+}
+
+// isBad returns true if the connection is discarded on close
+func (l *lazyConn) isBad() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bad
+}
+
+// close returns the connection to the pool if acquired, further get
+// returns ErrNoConnection
+func (l *lazyConn) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.conn == nil {
+		return
+	}
+
+	if l.bad {
+		discardConn(l.conn)
+		l.conn = nil
+		return
+	}
+
+	if l.reset != nil {
+		// request context may be done already
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := l.reset(ctx)
+		cancel()
+		if err != nil {
+			log.Println(err)
+			discardConn(l.conn)
+			l.conn = nil
+			return
+		}
+	}
+
+	l.conn.Close()
+	l.conn = nil
+}
+
+// discardConn closes conn and its driver connection instead of returning
+// it to the pool, e.g. when its session state can't be reset
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error {
+		return sqldriver.ErrBadConn
+	})
+	conn.Close()
+}
+
+// newDatabase returns Database for the pool, a single connection is
+// acquired on first use by either opening a new connection or returning an
+// existing connection from the connection pool. Queries run on the same
+// Database will be run in the same database session.
+//
+// Every Database must be returned to the database pool after use by
+// calling Database.Close.
+func newDatabase(ctx context.Context, p *pool, ping time.Duration) *Database {
+	scan, err := sqlscan.NewDBScanAPI(dbscan.WithStructTagKey(structTagKey))
 	if err != nil {
 		log.Fatal("error when create scanny Api")
 	}
 
 	return &Database{
-		context: ctx,
-		scan:    scan,
-		Conn:    conn,
-		DB:      db,
-	}, nil
+		context:    ctx,
+		bindtype:   p.bindtype,
+		drivername: p.drivername,
+		replicas:   p.replicas,
+		name:       p.name,
+		hooks:      p.hooks,
+		stmts:      p.stmts,
+		scan:       scan,
+		DB:         p.db,
+		lazy: &lazyConn{
+			ctx:  ctx,
+			pool: p,
+			ping: ping,
+		},
+	}
+}
+
+// conn returns Database of the named database pool, see newDatabase
+func (d *driver) conn(ctx context.Context, name string, ping time.Duration) (*Database, error) {
+	p, ok := d.databases[name]
+	if !ok {
+		return nil, fmt.Errorf(`database '%s' is not defined`, name)
+	}
+	return newDatabase(ctx, p, ping), nil
+}
+
+// Connection returns the single connection of Database, e.g. for other
+// packages that require a *sql.Conn. It is acquired from the pool on first
+// use. Connection blocks until either a connection is returned or the request
+// context is canceled.
+func (d *Database) Connection() (*sql.Conn, error) {
+	return d.lazy.get()
 }
 
 // Close returns the connection to the connection pool.
-// All operations after a Close will return with ErrConnDone.
+// All operations after a Close will return with ErrNoConnection.
 // Close is safe to call concurrently with other operations and will
 // block until all other operations finish. It may be useful to first
 // cancel any used context and then call close directly after.
+//
+// Close is a no-op inside Tx, the connection is owned by the outer Database.
 func (d *Database) Close() {
-	if d.Conn != nil {
-		d.Conn.Close()
+	if d.tx == nil {
+		d.lazy.close()
 	}
 }
 
 // buildquery convert named queries to positional queries, so they can
 // be executed directly by the database/sql without changing the working
-// system of sanitaze sql injection
-func (d *Database) BuildQuery(namedQuery string, namedArgs ...Map) (string, []interface{}, error) {
+// system of sanitaze sql injection.
+//
+// namedArgs can be Map, struct or pointer to struct, struct fields are
+// named by `jeen` tag like in scanning, see structFields.
+func (d *Database) BuildQuery(namedQuery string, namedArgs ...interface{}) (string, []interface{}, error) {
+	query, args, _, err := d.buildQuery(namedQuery, namedArgs)
+	return query, args, err
+}
+
+// buildQuery is BuildQuery that also returns the parameter name of each
+// argument
+func (d *Database) buildQuery(namedQuery string, namedArgs []interface{}) (string, []interface{}, []string, error) {
 	var query bytes.Buffer
-	var named bytes.Buffer
-	var namedIndex int = 1
-	var char rune
-	var width int
 	var args []interface{}
-	var field string
+	var names []string
 
-	_args := Map{}
-	for _, arg := range namedArgs {
-		for k, v := range arg {
-			_args[k] = v
-		}
+	_args, err := newNamedArgs(namedArgs)
+	if err != nil {
+		return "", nil, nil, err
 	}
 
-	for pos := 0; pos < len(namedQuery); {
-		char, width = utf8.DecodeRuneInString(namedQuery[pos:])
-		pos += width
+	parsed, err := parseQuery(namedQuery, d.bindtype, d.drivername)
+	if err != nil {
+		return "", nil, nil, err
+	}
 
-		if char == ':' {
-			named.Reset()
-			for {
-				char, width = utf8.DecodeRuneInString(namedQuery[pos:])
-				pos += width
+	for i, field := range parsed.names {
+		query.WriteString(parsed.text[i])
 
-				if unicode.IsLetter(char) || unicode.IsDigit(char) ||
-					char == '_' || char == '.' {
-					named.WriteRune(char)
-				} else {
-					break
-				}
-			}
-			if char == ':' {
-				query.WriteRune(char)
-			} else {
-
-				field = named.String()
-				if val, ok := _args[field]; ok {
-					args = append(args, val)
-				} else {
-					return query.String(), args, fmt.Errorf(`field '%s' is not defined`, field)
-				}
-
-				switch bindtype {
-				// oracle only supports named type bind vars even for positional
-				case NAMED:
-					query.WriteRune(':')
-					query.WriteString(field)
-				case QUESTION, UNKNOWN:
-					query.WriteRune('?')
-				case DOLLAR:
-					query.WriteRune('$')
-					query.WriteString(strconv.Itoa(namedIndex))
-				case AT:
-					query.WriteRune('@')
-					query.WriteRune('p')
-					query.WriteString(strconv.Itoa(namedIndex))
-				}
-				namedIndex++
-			}
+		val, ok := _args.lookup(field)
+		if !ok {
+			return query.String(), args, names, &MissingParamError{Name: field}
 		}
 
-		if char <= unicode.MaxASCII {
-			query.WriteRune(char)
+		// slice is expanded to one placeholder per element, so it can be
+		// used in IN clause, use Array to pass it as one argument
+		values, expanded := expandSlice(val)
+		if !expanded {
+			args = append(args, unwrapArray(val))
+			names = append(names, field)
+			d.writeBind(&query, field, len(args))
+			continue
+		}
+		if len(values) == 0 {
+			return query.String(), args, names, &EmptySliceError{Name: field}
 		}
+		for n, v := range values {
+			if n > 0 {
+				query.WriteString(", ")
+			}
+			args = append(args, v)
+			names = append(names, field)
+			d.writeBind(&query, field+"_"+strconv.Itoa(n+1), len(args))
+		}
+	}
+	query.WriteString(parsed.text[len(parsed.names)])
+
+	if unused := _args.unused(); len(unused) > 0 {
+		sort.Strings(unused)
+		return query.String(), args, names, &UnusedParamError{Names: unused}
+	}
+
+	return query.String(), args, names, nil
+}
+
+// writeBind write placeholder of the bind type, index is the position
+// of argument starting from 1
+func (d *Database) writeBind(query *bytes.Buffer, field string, index int) {
+	switch d.bindtype {
+	// oracle only supports named type bind vars even for positional
+	case NAMED:
+		query.WriteRune(':')
+		query.WriteString(strings.Replace(field, ".", "_", -1))
+	case QUESTION, UNKNOWN:
+		query.WriteRune('?')
+	case DOLLAR:
+		query.WriteRune('$')
+		query.WriteString(strconv.Itoa(index))
+	case AT:
+		query.WriteRune('@')
+		query.WriteRune('p')
+		query.WriteString(strconv.Itoa(index))
 	}
+}
 
-	return query.String(), args, nil
+// executor returns the transaction if inside Tx, otherwise the connection
+func (d *Database) executor() (executor, error) {
+	if d.tx != nil {
+		return d.tx, nil
+	}
+	return d.lazy.get()
 }
 
-// Query only store the query string and arguments without executing it.
+// Query only store the query string and arguments without executing it,
+// args can be Map, struct or pointer to struct.
 // see Result, Row and Exec for more information.
-func (d *Database) Query(query string, args ...Map) *SqlQuery {
-	qry, arg, err := d.BuildQuery(query, args...)
-	if err != nil {
-		log.Fatal(err)
+func (d *Database) Query(query string, args ...interface{}) *SqlQuery {
+	qry, arg, names, err := d.buildQuery(query, args)
+
+	// transaction always runs on primary
+	var replicas *replicas
+	if d.tx == nil {
+		replicas = d.replicas
 	}
 
 	return &SqlQuery{
-		context: d.context,
-		conn:    d.Conn,
-		scan:    d.scan,
-		query:   qry,
-		args:    arg,
+		context:  d.context,
+		db:       d,
+		replicas: replicas,
+		scan:     d.scan,
+		query:    qry,
+		args:     arg,
+		names:    names,
+		database: d.name,
+		hooks:    d.hooks,
+		err:      err,
 	}
 }
 
+// Err returns the error from building the query, if any. Result, Row and
+// Exec return the same error without executing the query.
+func (q *SqlQuery) Err() error {
+	return q.err
+}
+
 // Result return all rows from the query
 func (q *SqlQuery) Result(dest interface{}) error {
-	rows, err := q.conn.QueryContext(q.context, q.query, q.args...)
+	if q.err != nil {
+		return q.err
+	}
+
+	ctx, event := q.beforeQuery()
+	rows, err := q.queryContext(ctx)
 	if err != nil {
+		q.afterQuery(ctx, event, -1, err)
 		return err
 	}
 	defer rows.Close()
 
 	err = q.scan.ScanAll(dest, rows)
+	q.afterQuery(ctx, event, rowsOf(dest), err)
 	if err != nil {
 		return err
 	}
@@ -210,20 +532,41 @@ func (q *SqlQuery) Result(dest interface{}) error {
 
 // Row return only one row from the query
 func (q *SqlQuery) Row(dest interface{}) error {
-	rows, err := q.conn.QueryContext(q.context, q.query, q.args...)
+	if q.err != nil {
+		return q.err
+	}
+
+	ctx, event := q.beforeQuery()
+	rows, err := q.queryContext(ctx)
 	if err != nil {
+		q.afterQuery(ctx, event, -1, err)
 		return err
 	}
 	defer rows.Close()
 
 	err = q.scan.ScanOne(dest, rows)
 	if err != nil {
+		q.afterQuery(ctx, event, 0, err)
 		return err
 	}
+	q.afterQuery(ctx, event, 1, nil)
 	return nil
 }
 
 // Exec execute query
 func (q *SqlQuery) Exec() (sql.Result, error) {
-	return q.conn.ExecContext(q.context, q.query, q.args...)
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	ctx, event := q.beforeQuery()
+	result, err := q.execContext(ctx)
+	affected := int64(-1)
+	if err == nil {
+		if n, err := result.RowsAffected(); err == nil {
+			affected = n
+		}
+	}
+	q.afterQuery(ctx, event, affected, err)
+	return result, err
 }
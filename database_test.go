@@ -0,0 +1,120 @@
+package jeen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildQuerySlice(t *testing.T) {
+	tests := []struct {
+		name       string
+		drivername string
+		query      string
+		args       Map
+		want       string
+		wantArgs   []interface{}
+		err        string
+	}{
+		{
+			name:       "question",
+			drivername: "mysql",
+			query:      `SELECT * FROM u WHERE id IN (:ids) AND name = :name`,
+			args:       Map{"ids": []int{1, 2, 3}, "name": "a"},
+			want:       `SELECT * FROM u WHERE id IN (?, ?, ?) AND name = ?`,
+			wantArgs:   []interface{}{1, 2, 3, "a"},
+		},
+		{
+			name:       "dollar",
+			drivername: "pgx",
+			query:      `SELECT * FROM u WHERE id IN (:ids) AND name = :name`,
+			args:       Map{"ids": []int{1, 2, 3}, "name": "a"},
+			want:       `SELECT * FROM u WHERE id IN ($1, $2, $3) AND name = $4`,
+			wantArgs:   []interface{}{1, 2, 3, "a"},
+		},
+		{
+			name:       "at",
+			drivername: "sqlserver",
+			query:      `SELECT * FROM u WHERE id IN (:ids) AND name = :name`,
+			args:       Map{"ids": []int{1, 2, 3}, "name": "a"},
+			want:       `SELECT * FROM u WHERE id IN (@p1, @p2, @p3) AND name = @p4`,
+			wantArgs:   []interface{}{1, 2, 3, "a"},
+		},
+		{
+			name:       "named",
+			drivername: "godror",
+			query:      `SELECT * FROM u WHERE id IN (:ids) AND name = :name`,
+			args:       Map{"ids": []int{1, 2, 3}, "name": "a"},
+			want:       `SELECT * FROM u WHERE id IN (:ids_1, :ids_2, :ids_3) AND name = :name`,
+			wantArgs:   []interface{}{1, 2, 3, "a"},
+		},
+		{
+			name:       "named dotted",
+			drivername: "godror",
+			query:      `SELECT * FROM u WHERE id IN (:filter.ids)`,
+			args:       Map{"filter": Map{"ids": []int{1, 2}}},
+			want:       `SELECT * FROM u WHERE id IN (:filter_ids_1, :filter_ids_2)`,
+			wantArgs:   []interface{}{1, 2},
+		},
+		{
+			name:       "used twice",
+			drivername: "pgx",
+			query:      `SELECT * FROM u WHERE id IN (:ids) OR parent IN (:ids)`,
+			args:       Map{"ids": []string{"a", "b"}},
+			want:       `SELECT * FROM u WHERE id IN ($1, $2) OR parent IN ($3, $4)`,
+			wantArgs:   []interface{}{"a", "b", "a", "b"},
+		},
+		{
+			name:       "array",
+			drivername: "pgx",
+			query:      `SELECT * FROM u WHERE id IN (:ids)`,
+			args:       Map{"ids": [2]int{1, 2}},
+			want:       `SELECT * FROM u WHERE id IN ($1, $2)`,
+			wantArgs:   []interface{}{1, 2},
+		},
+		{
+			name:       "bytes are not expanded",
+			drivername: "pgx",
+			query:      `SELECT * FROM u WHERE data = :data`,
+			args:       Map{"data": []byte("ab")},
+			want:       `SELECT * FROM u WHERE data = $1`,
+			wantArgs:   []interface{}{[]byte("ab")},
+		},
+		{
+			name:       "Array is not expanded",
+			drivername: "pgx",
+			query:      `SELECT * FROM u WHERE id = ANY(:ids)`,
+			args:       Map{"ids": Array([]int{1, 2})},
+			want:       `SELECT * FROM u WHERE id = ANY($1)`,
+			wantArgs:   []interface{}{[]int{1, 2}},
+		},
+		{
+			name:       "empty slice",
+			drivername: "pgx",
+			query:      `SELECT * FROM u WHERE id IN (:ids)`,
+			args:       Map{"ids": []int{}},
+			err:        "field 'ids' is an empty slice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &Database{bindtype: BindType(tt.drivername), drivername: tt.drivername}
+			query, args, err := db.BuildQuery(tt.query, tt.args)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.want {
+				t.Errorf("query = %s, want %s", query, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
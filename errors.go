@@ -0,0 +1,166 @@
+package jeen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+
+	"github.com/georgysavva/scany/dbscan"
+)
+
+// HandlerErrorFunc is a route handler that returns error, the error is
+// responded by Config.ErrorHandler.
+//
+//	serv.Get("/users/{id}", func(res *jeen.Resource) error {
+//		var user User
+//		if err := res.Database.Query(`SELECT * FROM users WHERE id = :id`, jeen.Map{
+//			"id": res.Request.URLParam("id"),
+//		}).Row(&user); err != nil {
+//			return err // sql.ErrNoRows is 404
+//		}
+//		return res.Json.Success(user)
+//	})
+type HandlerErrorFunc func(res *Resource) error
+
+// ErrorHandler responds error returned by HandlerErrorFunc, see
+// DefaultErrorHandler
+type ErrorHandler func(res *Resource, err error)
+
+// HttpError is an error responded with status, message and details, e.g.
+//
+//	return jeen.NewHttpError(422, "invalid user", jeen.Map{"email": "required"})
+type HttpError struct {
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+
+	// cause of the error, logged but not sent to the client
+	Err error `json:"-"`
+}
+
+// NewHttpError creates HttpError of status, message default is the status
+// text, details is optional
+func NewHttpError(status int, message string, details ...interface{}) *HttpError {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	e := &HttpError{
+		Status:  status,
+		Message: message,
+	}
+	if len(details) > 0 {
+		e.Details = details[0]
+	}
+	return e
+}
+
+// Error implements error
+func (e *HttpError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %v", e.Status, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// Unwrap returns the cause of the error
+func (e *HttpError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is a panic of a route handler, it is raised again outside the
+// handler goroutine with the stack where the panic happened
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements error, the stack is included so it is logged by
+// middleware.Recoverer
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// toHttpError converts err to HttpError: sql.ErrNoRows (also no row of
+// SqlQuery.Row) and ErrUnknownTenant are 404, context deadline is 504,
+// other errors are 500 without the internal message
+func toHttpError(err error) *HttpError {
+	var e *HttpError
+	if errors.As(err, &e) {
+		return e
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, sql.ErrNoRows), dbscan.NotFound(err), errors.Is(err, ErrUnknownTenant):
+		status = http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+
+	e = NewHttpError(status, "")
+	e.Err = err
+	return e
+}
+
+// DefaultErrorHandler logs server errors and responds json when the client
+// wants json (see Request.WantsJson), otherwise a plain html page without
+// details.
+func DefaultErrorHandler(res *Resource, err error) {
+	e := toHttpError(err)
+	if e.Status >= http.StatusInternalServerError {
+		log.Println(err)
+	}
+
+	if res.Request.WantsJson() {
+		res.Json.Response(e.Status, e)
+		return
+	}
+
+	res.writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.writer.Header().Set("X-Content-Type-Options", "nosniff")
+	res.Html.ResponseString(e.Status, fmt.Sprintf(
+		"<!DOCTYPE html>\n<html><head><title>%d %s</title></head><body><h1>%s</h1></body></html>\n",
+		e.Status, html.EscapeString(http.StatusText(e.Status)), html.EscapeString(e.Message),
+	))
+}
+
+// handleError responds err with ErrorHandler of the config
+func (d *driver) handleError(res *Resource, err error) {
+	if d.errorHandler != nil {
+		d.errorHandler(res, err)
+		return
+	}
+	DefaultErrorHandler(res, err)
+}
+
+// routeHandler converts handler of a route to HandlerErrorFunc
+func routeHandler(handler interface{}) HandlerErrorFunc {
+	switch h := handler.(type) {
+	case HandlerErrorFunc:
+		return h
+	case func(res *Resource) error:
+		return h
+	case HandlerRouteFunc:
+		return func(res *Resource) error {
+			h(res)
+			return nil
+		}
+	case func(res *Resource):
+		return func(res *Resource) error {
+			h(res)
+			return nil
+		}
+	}
+	log.Fatalf("Handler %T, but only HandlerRouteFunc and HandlerErrorFunc are allowed.", handler)
+	return nil
+}
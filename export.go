@@ -0,0 +1,217 @@
+package jeen
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// ExportFormat is the output format of Resource.Export
+type ExportFormat string
+
+const (
+	// comma separated values with a header row of column names
+	ExportCSV ExportFormat = "csv"
+
+	// one json object per line
+	ExportNDJSON ExportFormat = "ndjson"
+
+	// json array of objects
+	ExportJSON ExportFormat = "json"
+)
+
+// rows written between flushes of Export
+const exportFlushRows = 100
+
+// Export streams the query result to the response as attachment, rows are
+// written as they are read so the result does not have to fit in memory.
+// Filename default is "export" with the format as extension. Values are
+// converted like Maps and json objects keep the column order.
+//
+//	err := res.Export(res.Database.Query(`SELECT * FROM orders`), jeen.ExportCSV, "orders.csv")
+//
+// An error before the first row is returned without writing anything, so
+// the handler can still respond. Export stops when the request context is
+// done, then the response is truncated and the context error is returned.
+// The request context ends at the WithTimeout of the route, 7 seconds
+// unless Default.WithTimeout is set, so large exports need a longer one:
+//
+//	serv.Get("/orders.csv", func(res *jeen.Resource) error {
+//		return res.Export(res.Database.Query(`SELECT * FROM orders`), jeen.ExportCSV, "orders.csv")
+//	}, jeen.WithTimeout(10*time.Minute))
+func (r *Resource) Export(query *SqlQuery, format ExportFormat, filename ...string) error {
+	var contentType string
+	switch format {
+	case ExportCSV:
+		contentType = "text/csv; charset=utf-8"
+	case ExportNDJSON:
+		contentType = "application/x-ndjson"
+	case ExportJSON:
+		contentType = "application/json; charset=utf-8"
+	default:
+		return fmt.Errorf("unknown export format '%s'", format)
+	}
+
+	name := "export." + string(format)
+	if len(filename) > 0 && filename[0] != "" {
+		name = filename[0]
+	}
+
+	if query.err != nil {
+		return query.err
+	}
+
+	ctx, event := query.beforeQuery()
+	rows, err := query.queryContext(ctx)
+	if err != nil {
+		query.afterQuery(ctx, event, -1, err)
+		return err
+	}
+	defer rows.Close()
+
+	scanner, err := newMapScanner(rows)
+	if err != nil {
+		query.afterQuery(ctx, event, -1, err)
+		return err
+	}
+	query.columns = scanner.columns
+
+	header := r.writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	r.writer.WriteHeader(http.StatusOK)
+
+	out := bufio.NewWriter(r.writer)
+	flush := func() error {
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		if f, ok := r.writer.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	var write func(values []interface{}) error
+	var end string
+
+	switch format {
+	case ExportCSV:
+		w := csv.NewWriter(out)
+		names := make([]string, len(scanner.columns))
+		for i, column := range scanner.columns {
+			names[i] = column.Name
+		}
+		if err := w.Write(names); err != nil {
+			query.afterQuery(ctx, event, 0, err)
+			return err
+		}
+
+		record := make([]string, len(scanner.columns))
+		write = func(values []interface{}) error {
+			for i, value := range values {
+				record[i] = csvValue(value)
+			}
+			w.Write(record)
+			// csv writer has its own buffer, pass the row to out
+			w.Flush()
+			return w.Error()
+		}
+
+	default:
+		keys := make([][]byte, len(scanner.columns))
+		for i, column := range scanner.columns {
+			keys[i], _ = json.Marshal(column.Name)
+		}
+
+		sep := "\n"
+		if format == ExportJSON {
+			out.WriteString("[")
+			sep, end = ",", "]"
+		}
+
+		first := true
+		write = func(values []interface{}) error {
+			if format == ExportJSON && !first {
+				out.WriteString(sep)
+			}
+			first = false
+
+			out.WriteString("{")
+			for i, value := range values {
+				if i > 0 {
+					out.WriteString(",")
+				}
+				data, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				out.Write(keys[i])
+				out.WriteString(":")
+				out.Write(data)
+			}
+			out.WriteString("}")
+			if format == ExportNDJSON {
+				out.WriteString(sep)
+			}
+			return nil
+		}
+	}
+
+	var count int64
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			query.afterQuery(ctx, event, count, err)
+			return err
+		}
+
+		values, err := scanner.scanValues(rows)
+		if err != nil {
+			query.afterQuery(ctx, event, count, err)
+			return err
+		}
+		if err := write(values); err != nil {
+			query.afterQuery(ctx, event, count, err)
+			return err
+		}
+
+		count++
+		if count%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				query.afterQuery(ctx, event, count, err)
+				return err
+			}
+		}
+	}
+
+	err = rows.Err()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		out.WriteString(end)
+		err = flush()
+	}
+	query.afterQuery(ctx, event, count, err)
+	return err
+}
+
+// csvValue format value of csv field, NULL is empty
+func csvValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
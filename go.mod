@@ -1,10 +1,10 @@
 module github.com/fuadarradhi/jeen
 
-go 1.14
+go 1.16
 
 require (
 	github.com/alexedwards/scs/v2 v2.5.0
 	github.com/georgysavva/scany v0.3.0
 	github.com/go-chi/chi/v5 v5.0.7
-	github.com/jackc/pgx/v4 v4.15.0 // indirect
+	github.com/jackc/pgx/v4 v4.15.0
 )
@@ -0,0 +1,223 @@
+package jeen
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// QueryHook observes every query executed by SqlQuery, register it in
+// Config.QueryHooks. BeforeQuery can return a new context (e.g. with a
+// tracing span) that is used to execute the query and passed to AfterQuery.
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, event *QueryEvent) context.Context
+	AfterQuery(ctx context.Context, event *QueryEvent)
+}
+
+// QueryEvent describes the executed query
+type QueryEvent struct {
+	// database name, see DefaultDatabase
+	Database string
+
+	// chi route pattern of the request, empty outside routing
+	Route string
+
+	// built query and bound arguments
+	Query string
+	Args  []interface{}
+
+	// named parameter of each argument, an expanded slice has the same
+	// name for every element
+	Names []string
+
+	// time when the query started and its duration, set before AfterQuery
+	Start    time.Time
+	Duration time.Duration
+
+	// rows affected by Exec or rows returned by Result, Row and Rows,
+	// -1 if unknown
+	RowsAffected int64
+
+	// error from executing or scanning the query
+	Err error
+}
+
+// beforeQuery create event and run BeforeQuery of every hook
+func (q *SqlQuery) beforeQuery() (context.Context, *QueryEvent) {
+	ctx := q.context
+	if len(q.hooks) == 0 {
+		return ctx, nil
+	}
+
+	event := &QueryEvent{
+		Database:     q.database,
+		Query:        q.query,
+		Args:         q.args,
+		Names:        q.names,
+		Start:        time.Now(),
+		RowsAffected: -1,
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		event.Route = rctx.RoutePattern()
+	}
+
+	for _, hook := range q.hooks {
+		ctx = hook.BeforeQuery(ctx, event)
+	}
+	return ctx, event
+}
+
+// afterQuery complete event and run AfterQuery of every hook in reverse
+func (q *SqlQuery) afterQuery(ctx context.Context, event *QueryEvent, rows int64, err error) {
+	if event == nil {
+		return
+	}
+
+	event.Duration = time.Since(event.Start)
+	event.RowsAffected = rows
+	event.Err = err
+
+	for i := len(q.hooks) - 1; i >= 0; i-- {
+		q.hooks[i].AfterQuery(ctx, event)
+	}
+}
+
+// rowsOf returns the number of scanned rows in dest slice, -1 if dest
+// is not a slice
+func rowsOf(dest interface{}) int64 {
+	v := reflect.ValueOf(dest)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return -1
+	}
+	return int64(v.Len())
+}
+
+// QueryLogger logs every query as key=value pairs. Arguments of the named
+// parameters in Redact are replaced with [REDACTED], use RedactAll to hide
+// every argument.
+//
+//	jeen.InitServer(&jeen.Config{
+//		QueryHooks: []jeen.QueryHook{
+//			&jeen.QueryLogger{Redact: []string{"password", "token"}},
+//		},
+//	})
+type QueryLogger struct {
+	// logger to write to, default is the standard logger
+	Logger *log.Logger
+
+	// parameter names to redact, case insensitive, a dotted name is
+	// matched by its last part
+	Redact []string
+
+	// redact every argument
+	RedactAll bool
+}
+
+func (l *QueryLogger) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+func (l *QueryLogger) AfterQuery(ctx context.Context, event *QueryEvent) {
+	logger := l.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Println(formatEvent("query", event, l.args(event)))
+}
+
+// args returns arguments of the event with redacted values
+func (l *QueryLogger) args(event *QueryEvent) []interface{} {
+	args := make([]interface{}, len(event.Args))
+	for i, arg := range event.Args {
+		args[i] = arg
+		if l.RedactAll {
+			args[i] = "[REDACTED]"
+			continue
+		}
+		if i >= len(event.Names) {
+			continue
+		}
+		name := event.Names[i]
+		if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+			name = name[dot+1:]
+		}
+		for _, redact := range l.Redact {
+			if strings.EqualFold(name, redact) {
+				args[i] = "[REDACTED]"
+				break
+			}
+		}
+	}
+	return args
+}
+
+// SlowQueryLogger logs queries that take longer than Threshold, arguments
+// are never logged. Use Report to send slow queries elsewhere.
+type SlowQueryLogger struct {
+	// minimum duration of a slow query
+	Threshold time.Duration
+
+	// logger to write to, default is the standard logger
+	Logger *log.Logger
+
+	// Report replaces logging when set
+	Report func(ctx context.Context, event *QueryEvent)
+}
+
+func (l *SlowQueryLogger) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+func (l *SlowQueryLogger) AfterQuery(ctx context.Context, event *QueryEvent) {
+	if event.Duration < l.Threshold {
+		return
+	}
+	if l.Report != nil {
+		l.Report(ctx, event)
+		return
+	}
+
+	logger := l.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Println(formatEvent("slow_query", event, nil))
+}
+
+// formatEvent format event as key=value pairs, args are omitted if nil
+func formatEvent(kind string, event *QueryEvent, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(kind)
+	b.WriteString(" database=")
+	b.WriteString(strconv.Quote(event.Database))
+	if event.Route != "" {
+		b.WriteString(" route=")
+		b.WriteString(strconv.Quote(event.Route))
+	}
+	b.WriteString(" duration=")
+	b.WriteString(event.Duration.String())
+	if event.RowsAffected >= 0 {
+		b.WriteString(" rows=")
+		b.WriteString(strconv.FormatInt(event.RowsAffected, 10))
+	}
+	if event.Err != nil {
+		b.WriteString(" error=")
+		b.WriteString(strconv.Quote(event.Err.Error()))
+	}
+	b.WriteString(" query=")
+	b.WriteString(strconv.Quote(event.Query))
+	if args != nil {
+		b.WriteString(" args=")
+		b.WriteString(strconv.Quote(fmt.Sprint(args)))
+	}
+	return b.String()
+}
@@ -0,0 +1,215 @@
+package jeen
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Column describes a result column of Maps and Map
+type Column struct {
+	Name string `json:"name"`
+
+	// database type name, e.g. VARCHAR, INT4 or DECIMAL, empty if the
+	// driver does not report it
+	Type string `json:"type"`
+
+	// nullable, length, precision and scale if the driver reports them
+	Nullable  bool  `json:"nullable"`
+	Length    int64 `json:"length,omitempty"`
+	Precision int64 `json:"precision,omitempty"`
+	Scale     int64 `json:"scale,omitempty"`
+}
+
+// Maps return all rows as Map keyed by column name, without declaring
+// the destination type. Values are converted to plain Go types so they
+// can be sent with Json or used in templates: []byte of text and numeric
+// columns becomes string, int64, float64 or bool by the column type,
+// decimal stays string to keep precision and binary columns stay []byte.
+// Use Columns for column order and types.
+//
+//	rows, err := res.Database.Query(`SELECT * FROM report`).Maps()
+//
+// A duplicate column name keeps the last value, use aliases in joins.
+func (q *SqlQuery) Maps() ([]Map, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	ctx, event := q.beforeQuery()
+	rows, err := q.queryContext(ctx)
+	if err != nil {
+		q.afterQuery(ctx, event, -1, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	result, err := q.scanMaps(rows)
+	q.afterQuery(ctx, event, int64(len(result)), err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Map return the first row as Map, see Maps. Only the first row is read,
+// it returns sql.ErrNoRows when there is no row.
+func (q *SqlQuery) Map() (Map, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	ctx, event := q.beforeQuery()
+	rows, err := q.queryContext(ctx)
+	if err != nil {
+		q.afterQuery(ctx, event, -1, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	scanner, err := newMapScanner(rows)
+	if err != nil {
+		q.afterQuery(ctx, event, -1, err)
+		return nil, err
+	}
+	q.columns = scanner.columns
+
+	if !rows.Next() {
+		err = rows.Err()
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		q.afterQuery(ctx, event, 0, err)
+		return nil, err
+	}
+
+	m, err := scanner.scan(rows)
+	if err == nil {
+		err = rows.Close()
+	}
+	if err != nil {
+		q.afterQuery(ctx, event, 0, err)
+		return nil, err
+	}
+	q.afterQuery(ctx, event, 1, nil)
+	return m, nil
+}
+
+// Columns returns result columns after Maps or Map
+func (q *SqlQuery) Columns() []Column {
+	return q.columns
+}
+
+// scanMaps scan every row into Map
+func (q *SqlQuery) scanMaps(rows *sql.Rows) ([]Map, error) {
+	scanner, err := newMapScanner(rows)
+	if err != nil {
+		return nil, err
+	}
+	q.columns = scanner.columns
+
+	result := []Map{}
+	for rows.Next() {
+		m, err := scanner.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
+
+// mapScanner scan rows into Map with converted values
+type mapScanner struct {
+	columns []Column
+	values  []interface{}
+	dest    []interface{}
+}
+
+// newMapScanner read columns of rows
+func newMapScanner(rows *sql.Rows) (*mapScanner, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mapScanner{
+		columns: make([]Column, len(types)),
+		values:  make([]interface{}, len(types)),
+		dest:    make([]interface{}, len(types)),
+	}
+	for i, t := range types {
+		column := Column{
+			Name: t.Name(),
+			Type: strings.ToUpper(t.DatabaseTypeName()),
+		}
+		column.Nullable, _ = t.Nullable()
+		column.Length, _ = t.Length()
+		column.Precision, column.Scale, _ = t.DecimalSize()
+		s.columns[i] = column
+		s.dest[i] = &s.values[i]
+	}
+	return s, nil
+}
+
+// scan current row into new Map
+func (s *mapScanner) scan(rows *sql.Rows) (Map, error) {
+	values, err := s.scanValues(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(Map, len(s.columns))
+	for i, column := range s.columns {
+		m[column.Name] = values[i]
+	}
+	return m, nil
+}
+
+// scanValues scan current row into converted values in column order,
+// the returned slice is reused by the next call
+func (s *mapScanner) scanValues(rows *sql.Rows) ([]interface{}, error) {
+	if err := rows.Scan(s.dest...); err != nil {
+		return nil, err
+	}
+	for i, column := range s.columns {
+		s.values[i] = convertValue(column.Type, s.values[i])
+	}
+	return s.values, nil
+}
+
+// convertValue convert []byte by database type, other values are kept
+func convertValue(typ string, value interface{}) interface{} {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+
+	// type name without size, e.g. VARCHAR(10) or UNSIGNED INT
+	if i := strings.IndexByte(typ, '('); i >= 0 {
+		typ = typ[:i]
+	}
+	typ = strings.TrimPrefix(strings.TrimSpace(typ), "UNSIGNED ")
+
+	switch typ {
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BYTEA", "BINARY", "VARBINARY", "IMAGE", "RAW", "LONG RAW":
+		// copy, the driver may reuse the buffer
+		return append([]byte(nil), b...)
+	case "INT", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT", "INT2", "INT4", "INT8", "YEAR":
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+			return n
+		}
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8", "DOUBLE PRECISION":
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
+		}
+	case "BOOL", "BOOLEAN":
+		if v, err := strconv.ParseBool(string(b)); err == nil {
+			return v
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage of Run
+const Usage = `Usage: migrate <command> [arguments]
+
+Commands:
+  up [N]       apply all or N pending migrations
+  down [N|all] roll back the last, N or all applied migrations
+  status       show applied and pending migrations
+  create NAME  create new up and down migration files`
+
+// invalid characters of migration name
+var nameReplacer = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Run executes migrate command from args, so it can be used as
+// subcommand of the application or by the jeen command.
+//
+//	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+//		err := migrate.Run(ctx, db, jeen.BindType("pgx"), "migrations", os.Args[2:], os.Stdout)
+//	}
+//
+// dir is the migrations directory on disk, create writes to it.
+func Run(ctx context.Context, db *sql.DB, bindtype int, dir string, args []string, out io.Writer, opts ...Options) error {
+	if len(args) == 0 {
+		return errors.New(Usage)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New(Usage)
+		}
+		up, down, err := Create(dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created %s\ncreated %s\n", up, down)
+		return nil
+	}
+
+	m := New(os.DirFS(dir), opts...)
+
+	switch args[0] {
+	case "up", "down":
+		steps := 0
+		if args[0] == "down" {
+			steps = 1
+		}
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			switch {
+			// Down rolls back everything with 0, so it must be explicit
+			case args[0] == "down" && args[1] == "all":
+				n = 0
+			case err != nil || n < 0 || (args[0] == "down" && n < 1):
+				return fmt.Errorf("invalid number of migrations: %s", args[1])
+			}
+			steps = n
+		}
+
+		var migrations []Migration
+		var err error
+		if args[0] == "up" {
+			migrations, err = m.Up(ctx, db, bindtype, steps)
+		} else {
+			migrations, err = m.Down(ctx, db, bindtype, steps)
+		}
+		for _, migration := range migrations {
+			fmt.Fprintf(out, "%s %d_%s\n", args[0], migration.Version, migration.Name)
+		}
+		if err == nil && len(migrations) == 0 {
+			fmt.Fprintln(out, "no migration to run")
+		}
+		return err
+
+	case "status":
+		migrations, err := m.Status(ctx, db, bindtype)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			status := "pending"
+			if migration.Applied {
+				status = "applied " + migration.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%d_%s\t%s\n", migration.Version, migration.Name, status)
+		}
+		return nil
+	}
+
+	return errors.New(Usage)
+}
+
+// Create writes empty up and down files to dir, version is the current
+// time formatted as yyyymmddhhmmss
+func Create(dir string, name string) (up string, down string, err error) {
+	name = strings.Trim(nameReplacer.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name is empty")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+
+	base := filepath.Join(dir, time.Now().UTC().Format("20060102150405")+"_"+name)
+	up, down = base+".up.sql", base+".down.sql"
+
+	for _, file := range []string{up, down} {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return "", "", err
+		}
+		f.Close()
+	}
+	return up, down, nil
+}
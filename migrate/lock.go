@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/fuadarradhi/jeen"
+)
+
+// ErrLockTimeout is returned when another process holds the lock longer
+// than the lock timeout
+var ErrLockTimeout = errors.New("timeout waiting for migration lock")
+
+// a lock older than this is left by a crashed process and can be taken
+const staleLock = 10 * time.Minute
+
+// locked runs fn on a single connection while holding the migration lock,
+// postgres uses advisory lock, other databases use a lock table
+func (m *Migrations) locked(ctx context.Context, db *sql.DB, bindtype int, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := m.createTable(ctx, conn, bindtype); err != nil {
+		return err
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, m.lockTimeout)
+	defer cancel()
+
+	var unlock func() error
+	if bindtype == jeen.DOLLAR {
+		unlock, err = m.advisoryLock(lockCtx, conn)
+	} else {
+		unlock, err = m.tableLock(lockCtx, conn, bindtype)
+	}
+	if err != nil {
+		if lockCtx.Err() == context.DeadlineExceeded {
+			return ErrLockTimeout
+		}
+		return err
+	}
+	defer unlock()
+
+	return fn(conn)
+}
+
+// advisoryLock holds postgres session advisory lock keyed by table name
+func (m *Migrations) advisoryLock(ctx context.Context, conn *sql.Conn) (func() error, error) {
+	key := int64(crc32.ChecksumIEEE([]byte(m.table)))
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+		return err
+	}, nil
+}
+
+// tableLock holds the lock by inserting the only row of lock table, other
+// processes wait until the row is deleted or becomes stale
+func (m *Migrations) tableLock(ctx context.Context, conn *sql.Conn, bindtype int) (func() error, error) {
+	table := m.table + "_lock"
+	err := createIfNotExists(ctx, conn, table, fmt.Sprintf(
+		`CREATE TABLE %s (id INT PRIMARY KEY, locked_at %s NOT NULL)`,
+		table, bigint(bindtype),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	insert := fmt.Sprintf(`INSERT INTO %s (id, locked_at) VALUES (1, %s)`, table, placeholder(bindtype, 1))
+	stale := fmt.Sprintf(`DELETE FROM %s WHERE id = 1 AND locked_at < %s`, table, placeholder(bindtype, 1))
+
+	for {
+		_, err := conn.ExecContext(ctx, insert, time.Now().Unix())
+		if err == nil {
+			break
+		}
+
+		// the row exists, remove it only if left by crashed process
+		if _, err := conn.ExecContext(ctx, stale, time.Now().Add(-staleLock).Unix()); err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	return func() error {
+		_, err := conn.ExecContext(context.Background(), fmt.Sprintf(`DELETE FROM %s WHERE id = 1`, table))
+		return err
+	}, nil
+}
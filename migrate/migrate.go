@@ -0,0 +1,367 @@
+// Package migrate evolves the database schema from versioned SQL files.
+//
+// Each migration is a pair of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, version is a number and migrations are applied
+// in ascending order. Applied versions are tracked in a table, and a lock
+// is held while migrating so concurrent deploys don't race.
+//
+// Migrations can be read from disk with os.DirFS or from embed.FS:
+//
+//	//go:embed migrations/*.sql
+//	var files embed.FS
+//
+//	source, _ := fs.Sub(files, "migrations")
+//	serv := jeen.InitServer(&jeen.Config{
+//		Driver: driver,
+//		Migrations: map[string]jeen.Migrator{
+//			jeen.DefaultDatabase: migrate.New(source),
+//		},
+//	})
+//
+// A file is executed with a single Exec, so the driver must support
+// multiple statements in one call (pgx and sqlite3 do, mysql needs
+// multiStatements=true). Every file runs inside a transaction, add the
+// line `-- jeen:no-transaction` to run it without one.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fuadarradhi/jeen"
+)
+
+// default table to track applied versions
+const DefaultTable = "schema_migrations"
+
+// marker to run migration file without transaction
+const noTransaction = "-- jeen:no-transaction"
+
+// migration file name, <version>_<name>.(up|down).sql
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migrations read from source, see New
+type Migrations struct {
+	// migration files
+	source fs.FS
+
+	// table to track applied versions
+	table string
+
+	// maximum time to wait for the lock
+	lockTimeout time.Duration
+}
+
+// Migration is a single version, with its status in the database
+type Migration struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+
+	// up and down file name in source
+	up   string
+	down string
+}
+
+type Options func(m *Migrations)
+
+// WithTable sets the table to track applied versions,
+// default is schema_migrations
+func WithTable(table string) Options {
+	return func(m *Migrations) {
+		m.table = table
+	}
+}
+
+// WithLockTimeout sets the maximum time to wait for another process
+// to finish migrating, default is 1 minute
+func WithLockTimeout(timeout time.Duration) Options {
+	return func(m *Migrations) {
+		m.lockTimeout = timeout
+	}
+}
+
+// New create migrations from source, the files are in the root of source
+func New(source fs.FS, opts ...Options) *Migrations {
+	m := &Migrations{
+		source:      source,
+		table:       DefaultTable,
+		lockTimeout: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Migrate applies all pending migrations, it implements jeen.Migrator
+// so migrations can run at InitServer time
+func (m *Migrations) Migrate(ctx context.Context, db *sql.DB, bindtype int) error {
+	_, err := m.Up(ctx, db, bindtype, 0)
+	return err
+}
+
+// Up applies pending migrations in ascending order, at most steps
+// migrations or all if steps is 0. It returns the applied migrations.
+func (m *Migrations) Up(ctx context.Context, db *sql.DB, bindtype int, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, db, bindtype, func(conn *sql.Conn) error {
+		migrations, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if migration.Applied {
+				continue
+			}
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if migration.up == "" {
+				return fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+			}
+			insert := fmt.Sprintf(`INSERT INTO %s (version, applied_at) VALUES (%s, %s)`,
+				m.table, placeholder(bindtype, 1), placeholder(bindtype, 2))
+			err := m.apply(ctx, conn, migration.up, insert, migration.Version, time.Now().Unix())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back applied migrations in descending order, at most steps
+// migrations or all if steps is 0. It returns the rolled back migrations.
+func (m *Migrations) Down(ctx context.Context, db *sql.DB, bindtype int, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, db, bindtype, func(conn *sql.Conn) error {
+		migrations, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			migration := migrations[i]
+			if !migration.Applied {
+				continue
+			}
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if migration.down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+			remove := fmt.Sprintf(`DELETE FROM %s WHERE version = %s`, m.table, placeholder(bindtype, 1))
+			err := m.apply(ctx, conn, migration.down, remove, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status returns every migration from source and the database, in
+// ascending order of version
+func (m *Migrations) Status(ctx context.Context, db *sql.DB, bindtype int) ([]Migration, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := m.createTable(ctx, conn, bindtype); err != nil {
+		return nil, err
+	}
+	return m.status(ctx, conn)
+}
+
+// apply executes the file and the version query, inside transaction
+// unless the file is marked with no-transaction
+func (m *Migrations) apply(ctx context.Context, conn *sql.Conn, file string, query string, args ...interface{}) error {
+	var content []byte
+	if file != "" {
+		var err error
+		content, err = fs.ReadFile(m.source, file)
+		if err != nil {
+			return err
+		}
+	}
+	script := string(content)
+
+	if strings.Contains(script, noTransaction) {
+		if strings.TrimSpace(script) != "" {
+			if _, err := conn.ExecContext(ctx, script); err != nil {
+				return err
+			}
+		}
+		_, err := conn.ExecContext(ctx, query, args...)
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// status merge migrations from source with applied versions
+func (m *Migrations) status(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	migrations, err := m.files()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(`SELECT version, applied_at FROM %s`, m.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byVersion := map[int64]int{}
+	for i, migration := range migrations {
+		byVersion[migration.Version] = i
+	}
+
+	for rows.Next() {
+		var version, appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		i, ok := byVersion[version]
+		if !ok {
+			// applied version without files, keep it so it shows in status
+			migrations = append(migrations, Migration{Version: version})
+			i = len(migrations) - 1
+		}
+		migrations[i].Applied = true
+		migrations[i].AppliedAt = time.Unix(appliedAt, 0)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// files read migrations from source
+func (m *Migrations) files() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.source, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.up = entry.Name()
+		} else {
+			migration.down = entry.Name()
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// createTable creates version table if not exists, existence is checked
+// with a select because not every database supports IF NOT EXISTS
+func (m *Migrations) createTable(ctx context.Context, conn *sql.Conn, bindtype int) error {
+	return createIfNotExists(ctx, conn, m.table, fmt.Sprintf(
+		`CREATE TABLE %s (version %s PRIMARY KEY, applied_at %s NOT NULL)`,
+		m.table, bigint(bindtype), bigint(bindtype),
+	))
+}
+
+// createIfNotExists run create when table does not exist
+func createIfNotExists(ctx context.Context, conn *sql.Conn, table string, create string) error {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(`SELECT 1 FROM %s WHERE 1 = 0`, table))
+	if err == nil {
+		return rows.Close()
+	}
+
+	if _, err := conn.ExecContext(ctx, create); err != nil {
+		// created by other process in the meantime
+		if rows, err2 := conn.QueryContext(ctx, fmt.Sprintf(`SELECT 1 FROM %s WHERE 1 = 0`, table)); err2 == nil {
+			return rows.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// bigint type name of the bind type
+func bigint(bindtype int) string {
+	if bindtype == jeen.NAMED {
+		return "NUMBER(19)"
+	}
+	return "BIGINT"
+}
+
+// placeholder of the bind type, index starting from 1
+func placeholder(bindtype int, index int) string {
+	switch bindtype {
+	case jeen.DOLLAR:
+		return "$" + strconv.Itoa(index)
+	case jeen.NAMED:
+		return ":v" + strconv.Itoa(index)
+	case jeen.AT:
+		return "@p" + strconv.Itoa(index)
+	}
+	return "?"
+}
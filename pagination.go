@@ -0,0 +1,459 @@
+package jeen
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// query parameters read by Request.PageParam, PerPageParam and CursorParam
+// and written by Page links
+const (
+	PageQueryParam    = "page"
+	PerPageQueryParam = "per_page"
+	CursorQueryParam  = "cursor"
+)
+
+// ErrInvalidCursor is returned when the cursor is malformed or does not
+// match the sorting of the query
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// Page is a page of query result with pagination metadata, it can be sent
+// with Json directly or used in Html templates:
+//
+//	page, err := res.Database.Query("SELECT * FROM users ORDER BY id").
+//		Paginate(res.Request.PageParam(), res.Request.PerPageParam(20, 100), &users)
+//
+//	res.Json.Success(page.SetLinks(res.Request))
+//
+// Page, Total and TotalPages are only set by offset pagination, total is
+// always sent so an empty result has total 0. Cursor pagination sets
+// NextCursor and PrevCursor, its json has no total and total_pages.
+type Page struct {
+	// pointer to the scanned slice
+	Items interface{} `json:"items"`
+
+	Page       int   `json:"page,omitempty"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+
+	// links of the current request, see SetLinks
+	Links *PageLinks `json:"links,omitempty"`
+
+	// url of the current request, see SetLinks
+	url *url.URL
+
+	// page of cursor pagination
+	cursor bool
+}
+
+// MarshalJSON omits total and total_pages of cursor pagination
+func (p Page) MarshalJSON() ([]byte, error) {
+	type page Page
+	if !p.cursor {
+		return json.Marshal(page(p))
+	}
+	return json.Marshal(struct {
+		page
+		Total      *int64 `json:"total,omitempty"`
+		TotalPages *int   `json:"total_pages,omitempty"`
+	}{page: page(p)})
+}
+
+// PageLinks are urls of the current request with page or cursor replaced,
+// empty if there is no such page
+type PageLinks struct {
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// PageParam returns page query parameter, 1 if missing or invalid
+func (r *Request) PageParam() int {
+	page, err := strconv.Atoi(r.QueryParam(PageQueryParam))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// PerPageParam returns per_page query parameter, def if missing or
+// invalid and max if greater than max
+func (r *Request) PerPageParam(def int, max int) int {
+	perPage, err := strconv.Atoi(r.QueryParam(PerPageQueryParam))
+	if err != nil || perPage < 1 {
+		return def
+	}
+	if perPage > max {
+		return max
+	}
+	return perPage
+}
+
+// CursorParam returns cursor query parameter
+func (r *Request) CursorParam() string {
+	return r.QueryParam(CursorQueryParam)
+}
+
+// Paginate scans the rows of page into dest and counts total rows. The
+// query must have ORDER BY for a stable result, sql server also does not
+// allow ORDER BY in the count subquery, use Builder.Paginate for it.
+func (q *SqlQuery) Paginate(page int, perPage int, dest interface{}) (*Page, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if page < 1 || perPage < 1 {
+		return nil, fmt.Errorf("invalid page %d or per page %d", page, perPage)
+	}
+
+	count := *q
+	count.query = "SELECT COUNT(*) FROM (" + q.query + ") jeen_count"
+
+	var items strings.Builder
+	items.WriteString(q.query)
+	writeLimit(&items, q.db.bindtype, perPage, (page-1)*perPage)
+	result := *q
+	result.query = items.String()
+
+	return paginate(&count, &result, page, perPage, dest)
+}
+
+// Paginate scans the rows of page into dest and counts total rows,
+// limit and offset of the builder are replaced
+func (b *Builder) Paginate(page int, perPage int, dest interface{}) (*Page, error) {
+	if page < 1 || perPage < 1 {
+		return nil, fmt.Errorf("invalid page %d or per page %d", page, perPage)
+	}
+
+	count := b.clone()
+	count.orderBy = nil
+	count.limit, count.offset = 0, 0
+	countQuery := count.Query()
+	if countQuery.err == nil {
+		countQuery.query = "SELECT COUNT(*) FROM (" + countQuery.query + ") jeen_count"
+	}
+
+	result := b.clone()
+	result.limit, result.offset = perPage, (page-1)*perPage
+
+	return paginate(countQuery, result.Query(), page, perPage, dest)
+}
+
+// paginate run count and result query of offset pagination
+func paginate(count *SqlQuery, result *SqlQuery, page int, perPage int, dest interface{}) (*Page, error) {
+	var total int64
+	if err := count.Row(&total); err != nil {
+		return nil, err
+	}
+	if err := result.Result(dest); err != nil {
+		return nil, err
+	}
+
+	return &Page{
+		Items:      dest,
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: int((total + int64(perPage) - 1) / int64(perPage)),
+	}, nil
+}
+
+// PaginateCursor scans the rows after (or before) cursor into dest with
+// keyset pagination, it is faster than offset on large tables but has no
+// total. The builder must have OrderBy with a unique last column (e.g. id)
+// and every sort column must be in the result. An empty cursor is the
+// first page.
+//
+//	page, err := res.Database.Select().From("users").
+//		Sortable("created_at", "id").OrderBy("-created_at", "id").
+//		PaginateCursor(res.Request.CursorParam(), 20, &users)
+func (b *Builder) PaginateCursor(cursor string, perPage int, dest interface{}) (*Page, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if perPage < 1 {
+		return nil, fmt.Errorf("invalid per page %d", perPage)
+	}
+	if len(b.orderBy) == 0 {
+		return nil, errors.New("cursor pagination needs OrderBy")
+	}
+
+	columns := make([]string, len(b.orderBy))
+	desc := make([]bool, len(b.orderBy))
+	for i, sort := range b.orderBy {
+		fields := strings.Fields(sort)
+		columns[i], desc[i] = fields[0], fields[1] == "DESC"
+	}
+
+	var c *pageCursor
+	if cursor != "" {
+		var err error
+		if c, err = decodeCursor(cursor, len(columns)); err != nil {
+			return nil, err
+		}
+	}
+
+	// previous page is read in reverse order, then reversed back
+	prev := c != nil && c.Prev
+	if prev {
+		for i := range desc {
+			desc[i] = !desc[i]
+		}
+	}
+
+	query := b.clone()
+	query.orderBy = make([]string, len(columns))
+	for i, column := range columns {
+		query.orderBy[i] = column + " ASC"
+		if desc[i] {
+			query.orderBy[i] = column + " DESC"
+		}
+	}
+	if c != nil {
+		query.Where(keysetCondition(columns, desc), keysetArgs(c.Values))
+	}
+	query.limit, query.offset = perPage+1, 0
+
+	if err := query.Query().Result(dest); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("dest must be a pointer to slice, got %T", dest)
+	}
+	items := v.Elem()
+	more := items.Len() > perPage
+	if more {
+		items.Set(items.Slice(0, perPage))
+	}
+	if prev {
+		swap := reflect.Swapper(items.Interface())
+		for i, j := 0, items.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	page := &Page{
+		Items:   dest,
+		PerPage: perPage,
+		cursor:  true,
+	}
+	if items.Len() == 0 {
+		return page, nil
+	}
+
+	// moving forward there is a next page if more rows exist and a previous
+	// page if it started from a cursor, moving backward the other way around
+	var err error
+	if more || prev {
+		if page.NextCursor, err = encodeCursor(items.Index(items.Len()-1), columns, false); err != nil {
+			return nil, err
+		}
+	}
+	if prev && more || !prev && c != nil {
+		if page.PrevCursor, err = encodeCursor(items.Index(0), columns, true); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// clone copy the builder so it can be changed without affecting b
+func (b *Builder) clone() *Builder {
+	c := *b
+	c.columns = append([]string(nil), b.columns...)
+	c.joins = append([]string(nil), b.joins...)
+	c.where = append([]string(nil), b.where...)
+	c.groupBy = append([]string(nil), b.groupBy...)
+	c.having = append([]string(nil), b.having...)
+	c.orderBy = append([]string(nil), b.orderBy...)
+	c.args = append([]interface{}(nil), b.args...)
+	return &c
+}
+
+// keysetCondition returns rows after the cursor in sort order:
+// a > :c0 OR (a = :c0 AND b > :c1) ...
+func keysetCondition(columns []string, desc []bool) string {
+	var conds []string
+	for i := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j]+" = :jeen_cursor_"+strconv.Itoa(j))
+		}
+		op := " > "
+		if desc[i] {
+			op = " < "
+		}
+		parts = append(parts, columns[i]+op+":jeen_cursor_"+strconv.Itoa(i))
+		conds = append(conds, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(conds, " OR ")
+}
+
+// keysetArgs returns named arguments of keysetCondition
+func keysetArgs(values []interface{}) Map {
+	args := Map{}
+	for i, value := range values {
+		args["jeen_cursor_"+strconv.Itoa(i)] = Array(value)
+	}
+	return args
+}
+
+// pageCursor is the encoded position of cursor pagination
+type pageCursor struct {
+	// values of sort columns of the first or last item
+	Values []interface{} `json:"v"`
+
+	// type of each value that is not kept by json
+	Types []string `json:"t,omitempty"`
+
+	// cursor of the previous page
+	Prev bool `json:"p,omitempty"`
+}
+
+// encodeCursor encode sort column values of item
+func encodeCursor(item reflect.Value, columns []string, prev bool) (string, error) {
+	c := pageCursor{
+		Values: make([]interface{}, len(columns)),
+		Types:  make([]string, len(columns)),
+		Prev:   prev,
+	}
+	for i, column := range columns {
+		// result has the column name without table
+		if dot := strings.LastIndexByte(column, '.'); dot >= 0 {
+			column = column[dot+1:]
+		}
+		value, ok := lookupValue(item, column)
+		if !ok {
+			return "", fmt.Errorf(`sort column '%s' is not in the result`, column)
+		}
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339Nano)
+			c.Types[i] = "time"
+		}
+		c.Values[i] = value
+	}
+
+	out, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// decodeCursor decode cursor with n sort columns
+func decodeCursor(cursor string, n int) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil || len(c.Values) != n {
+		return nil, ErrInvalidCursor
+	}
+
+	for i, value := range c.Values {
+		switch value := value.(type) {
+		case json.Number:
+			if n, err := value.Int64(); err == nil {
+				c.Values[i] = n
+			} else if f, err := value.Float64(); err == nil {
+				c.Values[i] = f
+			}
+		case string:
+			if i < len(c.Types) && c.Types[i] == "time" {
+				t, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return nil, ErrInvalidCursor
+				}
+				c.Values[i] = t
+			}
+		case nil, bool:
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+	return &c, nil
+}
+
+// SetLinks sets Links from the url of the request, it returns p so it
+// can be used inline
+func (p *Page) SetLinks(r *Request) *Page {
+	u := *r.Instance().URL
+	p.url = &u
+
+	links := &PageLinks{}
+	if p.Page > 0 {
+		links.First = p.URL(1)
+		if p.Page > 1 {
+			links.Prev = p.URL(p.Page - 1)
+		}
+		if p.Page < p.TotalPages {
+			links.Next = p.URL(p.Page + 1)
+			links.Last = p.URL(p.TotalPages)
+		}
+	}
+	if p.PrevCursor != "" {
+		links.Prev = p.link(CursorQueryParam, p.PrevCursor)
+	}
+	if p.NextCursor != "" {
+		links.Next = p.link(CursorQueryParam, p.NextCursor)
+	}
+	p.Links = links
+	return p
+}
+
+// URL returns url of page number, for templates after SetLinks:
+//
+//	{{ range .page.Numbers 2 }}<a href="{{ $.page.URL . }}">{{ . }}</a>{{ end }}
+func (p *Page) URL(page int) string {
+	return p.link(PageQueryParam, strconv.Itoa(page))
+}
+
+// Numbers returns page numbers around the current page, window is the
+// number of pages shown before and after it
+func (p *Page) Numbers(window int) []int {
+	from, to := p.Page-window, p.Page+window
+	if from < 1 {
+		from = 1
+	}
+	if to > p.TotalPages {
+		to = p.TotalPages
+	}
+
+	var numbers []int
+	for i := from; i <= to; i++ {
+		numbers = append(numbers, i)
+	}
+	return numbers
+}
+
+// link returns url of the request with query parameter replaced
+func (p *Page) link(name string, value string) string {
+	if p.url == nil {
+		return ""
+	}
+	u := *p.url
+	query := u.Query()
+	query.Set(name, value)
+	if name == CursorQueryParam {
+		query.Del(PageQueryParam)
+	}
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,37 @@
+package jeen
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPageJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		page *Page
+		want string
+	}{
+		{
+			name: "offset",
+			page: &Page{Items: []int{}, Page: 1, PerPage: 20},
+			want: `{"items":[],"page":1,"per_page":20,"total":0,"total_pages":0}`,
+		},
+		{
+			name: "cursor",
+			page: &Page{Items: []int{1}, PerPage: 20, NextCursor: "abc", cursor: true},
+			want: `{"items":[1],"per_page":20,"next_cursor":"abc"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := json.Marshal(tt.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("json = %s, want %s", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package jeen
+
+import (
+	sqldriver "database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/georgysavva/scany/dbscan"
+)
+
+// struct tag used for both scanning and named parameters
+const structTagKey = "jeen"
+
+// cache of field index by parameter name for each struct type
+var structFieldsCache sync.Map
+
+// arrayArg is an argument that is never expanded, see Array
+type arrayArg struct {
+	value interface{}
+}
+
+// Array pass slice or array as a single argument instead of expanding it
+// to one placeholder per element, for drivers that accept native arrays
+// like pgx.
+//
+//	res.Database.Query(`SELECT * FROM users WHERE id = ANY(:ids)`, jeen.Map{
+//	    "ids": jeen.Array([]int{1, 2, 3}),
+//	})
+func Array(value interface{}) interface{} {
+	return arrayArg{value: value}
+}
+
+// unwrapArray returns the original value of Array
+func unwrapArray(value interface{}) interface{} {
+	if a, ok := value.(arrayArg); ok {
+		return a.value
+	}
+	return value
+}
+
+// expandSlice returns elements of slice or array, []byte, driver.Valuer
+// and Array are not expanded
+func expandSlice(value interface{}) ([]interface{}, bool) {
+	switch value.(type) {
+	case arrayArg, []byte, sqldriver.Valuer:
+		return nil, false
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values, true
+}
+
+// namedArgs resolves named parameters from Map, struct or pointer to
+// struct, later arguments override earlier ones like merging Maps
+type namedArgs struct {
+	values []reflect.Value
+	used   map[string]bool
+}
+
+// create namedArgs from Query arguments, only Map, struct and pointer to
+// struct are allowed
+func newNamedArgs(args []interface{}) (*namedArgs, error) {
+	n := &namedArgs{
+		used: map[string]bool{},
+	}
+	for _, arg := range args {
+		v := reflect.ValueOf(arg)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		switch {
+		case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		case v.Kind() == reflect.Struct:
+		default:
+			return nil, fmt.Errorf(`argument type %T is not supported, use Map or struct`, arg)
+		}
+		n.values = append(n.values, v)
+	}
+	return n, nil
+}
+
+// lookup returns value of the named parameter, dotted names are resolved
+// into nested Map or struct
+func (n *namedArgs) lookup(name string) (interface{}, bool) {
+	for i := len(n.values) - 1; i >= 0; i-- {
+		v := n.values[i]
+		if v.Kind() == reflect.Map {
+			if val, key, ok := lookupMap(v, name); ok {
+				n.used[key] = true
+				return val, true
+			}
+			continue
+		}
+		if val, ok := lookupStruct(v, name); ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// unused returns Map keys that are not used by any parameter, struct
+// fields are not reported
+func (n *namedArgs) unused() []string {
+	var names []string
+	for _, v := range n.values {
+		if v.Kind() != reflect.Map {
+			continue
+		}
+		for _, key := range v.MapKeys() {
+			if !n.used[key.String()] {
+				names = append(names, key.String())
+			}
+		}
+	}
+	return names
+}
+
+// lookupMap returns value and the Map key used, the full name is tried
+// first, then the name is split on dots from the longest key
+func lookupMap(v reflect.Value, name string) (interface{}, string, bool) {
+	if val := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); val.IsValid() {
+		return val.Interface(), name, true
+	}
+
+	for i := strings.LastIndexByte(name, '.'); i > 0; i = strings.LastIndexByte(name[:i], '.') {
+		val := v.MapIndex(reflect.ValueOf(name[:i]).Convert(v.Type().Key()))
+		if !val.IsValid() {
+			continue
+		}
+		if nested, ok := lookupValue(reflect.ValueOf(val.Interface()), name[i+1:]); ok {
+			return nested, name[:i], true
+		}
+	}
+	return nil, "", false
+}
+
+// lookupValue resolve name from Map or struct value
+func lookupValue(v reflect.Value, name string) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		val, _, ok := lookupMap(v, name)
+		return val, ok
+	case v.Kind() == reflect.Struct:
+		return lookupStruct(v, name)
+	}
+	return nil, false
+}
+
+// lookupStruct returns value of struct field by parameter name, a nil
+// pointer along the way gives nil value (NULL)
+func lookupStruct(v reflect.Value, name string) (interface{}, bool) {
+	index, ok := structFields(v.Type()).index[name]
+	if !ok {
+		return nil, false
+	}
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, true
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	if !v.CanInterface() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// fields of struct type by parameter name
+type structInfo struct {
+	// field index by name
+	index map[string][]int
+
+	// names in field order
+	names []string
+
+	// fields with `readonly` tag option, skipped by Insert and Upsert
+	readonly map[string]bool
+}
+
+// structFields returns fields of struct type by parameter name, it follows
+// scany rules so the same struct can be used for scanning and parameters:
+// name from `jeen` tag or snake case of field name, fields of embedded
+// struct are promoted and nested struct fields are prefixed with dot.
+func structFields(t reflect.Type) *structInfo {
+	if cached, ok := structFieldsCache.Load(t); ok {
+		return cached.(*structInfo)
+	}
+
+	type traverse struct {
+		typ    reflect.Type
+		index  []int
+		prefix string
+	}
+
+	result := &structInfo{
+		index:    map[string][]int{},
+		readonly: map[string]bool{},
+	}
+	queue := []traverse{{typ: t}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for i := 0; i < current.typ.NumField(); i++ {
+			field := current.typ.Field(i)
+
+			// unexported field
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+
+			tag, tagPresent := field.Tag.Lookup(structTagKey)
+			var tagOptions []string
+			if tagPresent {
+				parts := strings.Split(tag, ",")
+				tag, tagOptions = parts[0], parts[1:]
+			}
+			if tag == "-" {
+				continue
+			}
+
+			index := make([]int, 0, len(current.index)+1)
+			index = append(index, current.index...)
+			index = append(index, i)
+
+			part := tag
+			if !tagPresent {
+				part = dbscan.SnakeCaseMapper(field.Name)
+			}
+			if !field.Anonymous {
+				name := joinName(current.prefix, part)
+				if _, exists := result.index[name]; !exists {
+					result.index[name] = index
+					result.names = append(result.names, name)
+					for _, option := range tagOptions {
+						if option == "readonly" {
+							result.readonly[name] = true
+						}
+					}
+				}
+			}
+
+			child := field.Type
+			if child.Kind() == reflect.Ptr {
+				child = child.Elem()
+			}
+			if child.Kind() == reflect.Struct {
+				// embedded struct without tag is promoted
+				if field.Anonymous {
+					part = tag
+				}
+				queue = append(queue, traverse{
+					typ:    child,
+					index:  index,
+					prefix: joinName(current.prefix, part),
+				})
+			}
+		}
+	}
+
+	structFieldsCache.Store(t, result)
+	return result
+}
+
+// join non empty name parts with dot
+func joinName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	if name == "" {
+		return prefix
+	}
+	return prefix + "." + name
+}
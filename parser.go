@@ -0,0 +1,247 @@
+package jeen
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// parsedQuery is a named query split by its parameters, text always has
+// one more element than names, so the query is
+// text[0] + names[0] + text[1] + ... + text[n]
+type parsedQuery struct {
+	text  []string
+	names []string
+}
+
+// lexer for named queries, it understands string literals, quoted
+// identifiers, comments, casts and dollar-quoted bodies for each bind type,
+// so a colon inside them is never treated as a parameter
+type lexer struct {
+	input    string
+	bindtype int
+	pos      int
+	start    int
+	parsed   parsedQuery
+
+	// backslash escapes in quoted strings, mysql only
+	backslash bool
+}
+
+// parseQuery split named query into text and parameter names, all text
+// is preserved verbatim
+func parseQuery(query string, bindtype int, drivername string) (*parsedQuery, error) {
+	l := &lexer{
+		input:     query,
+		bindtype:  bindtype,
+		backslash: bindtype == QUESTION && strings.Contains(drivername, "mysql"),
+	}
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	return &l.parsed, nil
+}
+
+// peek returns the rune at offset from the current position without
+// consuming it, utf8.RuneError with zero width at the end of input
+func (l *lexer) peek(offset int) (rune, int) {
+	if l.pos+offset >= len(l.input) {
+		return utf8.RuneError, 0
+	}
+	return utf8.DecodeRuneInString(l.input[l.pos+offset:])
+}
+
+func (l *lexer) run() error {
+	for l.pos < len(l.input) {
+		char, width := l.peek(0)
+		next, _ := l.peek(width)
+
+		var err error
+		switch {
+		// backslash escapes follow mysql, sqlite has none
+		case char == '\'':
+			escape := l.backslash || l.isEscapeString()
+			err = l.quoted('\'', escape, "unterminated string literal")
+		case char == '"':
+			err = l.quoted('"', l.backslash, "unterminated quoted identifier")
+		case char == '`' && l.bindtype == QUESTION:
+			err = l.quoted('`', false, "unterminated quoted identifier")
+		case char == '[' && l.bindtype == AT:
+			err = l.quoted(']', false, "unterminated quoted identifier")
+		case char == '-' && next == '-':
+			l.lineComment()
+		case char == '/' && next == '*':
+			err = l.blockComment()
+		case char == '$' && l.bindtype == DOLLAR:
+			err = l.dollarQuoted()
+		case char == ':':
+			l.colon()
+		default:
+			l.pos += width
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	l.parsed.text = append(l.parsed.text, l.input[l.start:])
+	return nil
+}
+
+// isEscapeString returns true for postgres E'...' string constants
+func (l *lexer) isEscapeString() bool {
+	if l.bindtype != DOLLAR || l.pos == 0 {
+		return false
+	}
+	prev := l.input[l.pos-1]
+	if prev != 'E' && prev != 'e' {
+		return false
+	}
+	if l.pos == 1 {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(l.input[:l.pos-1])
+	return !isIdentRune(before)
+}
+
+// quoted consume string literal or quoted identifier, the closing quote
+// is escaped by doubling it, or with backslash when escape is true
+func (l *lexer) quoted(end rune, escape bool, message string) error {
+	begin := l.pos
+	_, width := l.peek(0)
+	l.pos += width
+
+	for l.pos < len(l.input) {
+		char, width := l.peek(0)
+		l.pos += width
+
+		if escape && char == '\\' {
+			_, width = l.peek(0)
+			l.pos += width
+			continue
+		}
+		if char == end {
+			if next, width := l.peek(0); next == end {
+				l.pos += width
+				continue
+			}
+			return nil
+		}
+	}
+
+	return &ParseError{Pos: begin, Message: message}
+}
+
+// lineComment consume -- comment until end of line
+func (l *lexer) lineComment() {
+	if i := strings.IndexByte(l.input[l.pos:], '\n'); i >= 0 {
+		l.pos += i + 1
+		return
+	}
+	l.pos = len(l.input)
+}
+
+// blockComment consume /* */ comment, postgres allows nested comments
+func (l *lexer) blockComment() error {
+	begin := l.pos
+	depth := 0
+
+	for l.pos < len(l.input) {
+		switch {
+		case strings.HasPrefix(l.input[l.pos:], "/*"):
+			if depth == 0 || l.bindtype == DOLLAR {
+				depth++
+			}
+			l.pos += 2
+		case strings.HasPrefix(l.input[l.pos:], "*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return nil
+			}
+		default:
+			_, width := l.peek(0)
+			l.pos += width
+		}
+	}
+
+	return &ParseError{Pos: begin, Message: "unterminated block comment"}
+}
+
+// dollarQuoted consume postgres $tag$ ... $tag$ body, $1 and identifiers
+// containing $ are left as they are
+func (l *lexer) dollarQuoted() error {
+	begin := l.pos
+
+	if l.pos > 0 {
+		before, _ := utf8.DecodeLastRuneInString(l.input[:l.pos])
+		if isIdentRune(before) {
+			l.pos++
+			return nil
+		}
+	}
+
+	end := 1
+	for {
+		char, width := l.peek(end)
+		if char == '$' {
+			end++
+			break
+		}
+		if width == 0 || !isIdentRune(char) || (end == 1 && unicode.IsDigit(char)) {
+			l.pos++
+			return nil
+		}
+		end += width
+	}
+
+	tag := l.input[l.pos : l.pos+end]
+	l.pos += end
+
+	i := strings.Index(l.input[l.pos:], tag)
+	if i < 0 {
+		return &ParseError{Pos: begin, Message: "unterminated dollar-quoted string"}
+	}
+	l.pos += i + len(tag)
+	return nil
+}
+
+// colon consume cast (::), assignment (:=) or named parameter
+func (l *lexer) colon() {
+	next, width := l.peek(1)
+
+	if next == ':' || next == '=' {
+		l.pos += 1 + width
+		return
+	}
+
+	if !unicode.IsLetter(next) && next != '_' {
+		l.pos++
+		return
+	}
+
+	begin := l.pos
+	end := l.pos + 1
+	for end < len(l.input) {
+		char, width := utf8.DecodeRuneInString(l.input[end:])
+		if !isIdentRune(char) && char != '.' {
+			break
+		}
+		end += width
+	}
+
+	// trailing dot is not part of the name
+	for l.input[end-1] == '.' {
+		end--
+	}
+
+	l.parsed.text = append(l.parsed.text, l.input[l.start:begin])
+	l.parsed.names = append(l.parsed.names, l.input[begin+1:end])
+	l.pos = end
+	l.start = end
+}
+
+// isIdentRune returns true if char can be part of an identifier
+func isIdentRune(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+}
@@ -0,0 +1,128 @@
+package jeen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		drivername string
+		query      string
+		names      []string
+		err        string
+	}{
+		{
+			name:       "params",
+			drivername: "pgx",
+			query:      `SELECT * FROM u WHERE id = :id AND name = :user.name.`,
+			names:      []string{"id", "user.name"},
+		},
+		{
+			name:       "cast and assignment",
+			drivername: "pgx",
+			query:      `SELECT :id::int, x := 1`,
+			names:      []string{"id"},
+		},
+		{
+			name:       "colon in literals and comments",
+			drivername: "pgx",
+			query:      "SELECT ':a', \":b\" -- :c\n/* :d /* :e */ */ FROM t WHERE id = :id",
+			names:      []string{"id"},
+		},
+		{
+			name:       "postgres dollar quoted",
+			drivername: "pgx",
+			query:      `SELECT $tag$ :a $tag$, $$ :b $$, $1, a$b FROM t WHERE id = :id`,
+			names:      []string{"id"},
+		},
+		{
+			name:       "postgres escape string",
+			drivername: "pgx",
+			query:      `SELECT E'it\'s :a' WHERE id = :id`,
+			names:      []string{"id"},
+		},
+		{
+			name:       "postgres backslash is not escape",
+			drivername: "pgx",
+			query:      `SELECT 'C:\' WHERE id = :id`,
+			names:      []string{"id"},
+		},
+		{
+			name:       "mysql backslash escape",
+			drivername: "mysql",
+			query:      "SELECT 'it\\'s :a', \"\\\":b\", `:c` WHERE id = :id",
+			names:      []string{"id"},
+		},
+		{
+			name:       "sqlite backslash is not escape",
+			drivername: "sqlite3",
+			query:      `SELECT * FROM f WHERE path = 'C:\' AND id = :id`,
+			names:      []string{"id"},
+		},
+		{
+			name:       "nrsqlite3 backslash is not escape",
+			drivername: "nrsqlite3",
+			query:      `SELECT * FROM f WHERE path = 'C:\' AND id = :id`,
+			names:      []string{"id"},
+		},
+		{
+			name:       "sql server brackets",
+			drivername: "sqlserver",
+			query:      `SELECT [a:b] FROM t WHERE id = :id`,
+			names:      []string{"id"},
+		},
+		{
+			name:       "unterminated string",
+			drivername: "pgx",
+			query:      `SELECT 'abc WHERE id = :id`,
+			err:        "parse error at 7: unterminated string literal",
+		},
+		{
+			name:       "mysql escaped quote is unterminated",
+			drivername: "mysql",
+			query:      `SELECT 'C:\' AND id = :id`,
+			err:        "parse error at 7: unterminated string literal",
+		},
+		{
+			name:       "unterminated comment",
+			drivername: "pgx",
+			query:      `SELECT 1 /* :id`,
+			err:        "parse error at 9: unterminated block comment",
+		},
+		{
+			name:       "unterminated dollar quoted",
+			drivername: "pgx",
+			query:      `SELECT $x$ :id`,
+			err:        "parse error at 7: unterminated dollar-quoted string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseQuery(tt.query, BindType(tt.drivername), tt.drivername)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed.names, tt.names) {
+				t.Errorf("names = %q, want %q", parsed.names, tt.names)
+			}
+
+			// text is preserved verbatim
+			query := parsed.text[0]
+			for i, name := range parsed.names {
+				query += ":" + name + parsed.text[i+1]
+			}
+			if query != tt.query {
+				t.Errorf("query = %q, want %q", query, tt.query)
+			}
+		})
+	}
+}
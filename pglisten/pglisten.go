@@ -0,0 +1,328 @@
+// Package pglisten dispatches postgres LISTEN/NOTIFY notifications to
+// handlers, subscribers and server sent events. It requires the pgx driver
+// and is kept out of package jeen so other drivers don't link pgx.
+package pglisten
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fuadarradhi/jeen"
+	"github.com/jackc/pgx/v4"
+)
+
+// buffered notifications of each subscriber, more are dropped
+const listenerBuffer = 16
+
+// wait before reconnecting, doubled after every failure up to maximum
+const (
+	listenerMinBackoff = time.Second
+	listenerMaxBackoff = 30 * time.Second
+)
+
+// interval of comment sent by ServeEvents to keep the connection open
+const eventsKeepAlive = 15 * time.Second
+
+// Notification is a payload sent with postgres NOTIFY
+type Notification struct {
+	Channel string `json:"channel"`
+	Payload string `json:"payload"`
+
+	// process id of the sending session
+	PID uint32 `json:"pid"`
+}
+
+// Listener holds a dedicated postgres connection that LISTEN to channels
+// and dispatches notifications to handlers and subscribers. The connection
+// is opened again when it fails, notifications sent while reconnecting are
+// lost.
+type Listener struct {
+	db *sql.DB
+
+	mu          sync.Mutex
+	handlers    map[string][]func(n *Notification)
+	subscribers map[string]map[chan *Notification]bool
+
+	// interrupt waiting so new channels are listened
+	wake func()
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// New starts listener of db opened with the pgx driver, Close stops it.
+//
+//	listener := pglisten.New(serv.DB(jeen.DefaultDatabase))
+//	defer listener.Close()
+//
+//	listener.Handle("orders", func(n *pglisten.Notification) {
+//		log.Println("order changed", n.Payload)
+//	})
+func New(db *sql.DB) *Listener {
+	l := &Listener{
+		db:          db,
+		handlers:    map[string][]func(n *Notification){},
+		subscribers: map[string]map[chan *Notification]bool{},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Handle registers handler of channel, handlers run one by one in the
+// listener goroutine so they must not block for long
+func (l *Listener) Handle(channel string, handler func(n *Notification)) {
+	l.mu.Lock()
+	l.handlers[channel] = append(l.handlers[channel], handler)
+	l.mu.Unlock()
+	l.interrupt()
+}
+
+// Subscribe returns notifications of channels until cancel is called, e.g.
+// to forward them to a WebSocket client. Notifications are dropped when
+// the subscriber is slower than the buffer.
+func (l *Listener) Subscribe(channels ...string) (<-chan *Notification, func()) {
+	ch := make(chan *Notification, listenerBuffer)
+
+	l.mu.Lock()
+	for _, channel := range channels {
+		if l.subscribers[channel] == nil {
+			l.subscribers[channel] = map[chan *Notification]bool{}
+		}
+		l.subscribers[channel][ch] = true
+	}
+	l.mu.Unlock()
+	l.interrupt()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			for _, channel := range channels {
+				delete(l.subscribers[channel], ch)
+			}
+			l.mu.Unlock()
+		})
+	}
+}
+
+// Notify sends payload to channel with pg_notify
+func (l *Listener) Notify(ctx context.Context, channel string, payload string) error {
+	_, err := l.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, payload)
+	return err
+}
+
+// ServeEvents forwards notifications of channels to the client as server
+// sent events, the event name is the channel. It returns when the request
+// context is done, so the route needs a long WithTimeout:
+//
+//	serv.Get("/events", func(res *jeen.Resource) error {
+//		return listener.ServeEvents(res, "orders")
+//	}, jeen.WithTimeout(time.Hour))
+func (l *Listener) ServeEvents(res *jeen.Resource, channels ...string) error {
+	w := res.Writer.Instance()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("response writer does not support flush")
+	}
+
+	notifications, cancel := l.Subscribe(channels...)
+	defer cancel()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var event string
+		select {
+		case <-res.Context.Done():
+			return res.Context.Err()
+		case <-keepAlive.C:
+			event = ": keep-alive\n\n"
+		case n := <-notifications:
+			event = "event: " + n.Channel + "\ndata: " +
+				strings.ReplaceAll(n.Payload, "\n", "\ndata: ") + "\n\n"
+		}
+
+		if _, err := w.Write([]byte(event)); err != nil {
+			return err
+		}
+		flusher.Flush()
+	}
+}
+
+// Close stops the listener and waits until its connection is released
+func (l *Listener) Close() {
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+	})
+}
+
+// interrupt waiting for notification so new channels are listened
+func (l *Listener) interrupt() {
+	l.mu.Lock()
+	wake := l.wake
+	l.mu.Unlock()
+	if wake != nil {
+		wake()
+	}
+}
+
+// channels returns every channel with handler or subscriber
+func (l *Listener) channels() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var channels []string
+	for channel := range l.handlers {
+		channels = append(channels, channel)
+	}
+	for channel := range l.subscribers {
+		if _, ok := l.handlers[channel]; !ok {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// run listens until close is called, reconnecting with backoff
+func (l *Listener) run() {
+	defer close(l.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-l.stop
+		cancel()
+	}()
+
+	backoff := listenerMinBackoff
+	for {
+		start := time.Now()
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Listener failed, reconnecting in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		// reset backoff after a connection that worked for a while
+		if time.Since(start) > listenerMaxBackoff {
+			backoff = listenerMinBackoff
+		} else if backoff *= 2; backoff > listenerMaxBackoff {
+			backoff = listenerMaxBackoff
+		}
+	}
+}
+
+// listen holds a connection and dispatches notifications until it fails
+// or ctx is done
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pc, ok := driverConn.(interface{ Conn() *pgx.Conn })
+		if !ok {
+			return errors.New("listener requires the pgx driver")
+		}
+		c := pc.Conn()
+
+		// the connection goes back to the pool, stop listening
+		defer func() {
+			if !c.IsClosed() {
+				c.Exec(context.Background(), "UNLISTEN *")
+			}
+		}()
+
+		listened := map[string]bool{}
+		for {
+			// set wake before reading channels, so a channel added
+			// meanwhile interrupts the wait below
+			waitCtx, wake := context.WithCancel(ctx)
+			l.mu.Lock()
+			l.wake = wake
+			l.mu.Unlock()
+
+			for _, channel := range l.channels() {
+				if listened[channel] {
+					continue
+				}
+				if _, err := c.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+					wake()
+					return err
+				}
+				listened[channel] = true
+			}
+
+			n, err := c.WaitForNotification(waitCtx)
+
+			l.mu.Lock()
+			l.wake = nil
+			l.mu.Unlock()
+			wake()
+
+			if err != nil {
+				// interrupted to listen new channels
+				if waitCtx.Err() != nil && ctx.Err() == nil {
+					continue
+				}
+				return err
+			}
+
+			l.dispatch(&Notification{
+				Channel: n.Channel,
+				Payload: n.Payload,
+				PID:     n.PID,
+			})
+		}
+	})
+}
+
+// dispatch notification to handlers and subscribers of its channel
+func (l *Listener) dispatch(n *Notification) {
+	l.mu.Lock()
+	handlers := l.handlers[n.Channel]
+	for ch := range l.subscribers[n.Channel] {
+		select {
+		case ch <- n:
+		default:
+		}
+	}
+	l.mu.Unlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					log.Printf("Listener handler of '%s' panic: %v", n.Channel, p)
+				}
+			}()
+			handler(n)
+		}()
+	}
+}
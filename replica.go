@@ -0,0 +1,123 @@
+package jeen
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// interval of replica health check
+const replicaCheckInterval = 5 * time.Second
+
+// replica database/sql DB pool with its health status
+type replica struct {
+	db      *sql.DB
+	healthy int32
+}
+
+// replicas of a database, reads are balanced with round-robin between
+// healthy replicas and fallback to primary when none is healthy
+type replicas struct {
+	list []*replica
+	next uint32
+	stop chan struct{}
+	once sync.Once
+}
+
+// create replicas and start health check in background,
+// stop it with close
+func newReplicas(dbs []*sql.DB) *replicas {
+	r := &replicas{
+		stop: make(chan struct{}),
+	}
+	for _, db := range dbs {
+		r.list = append(r.list, &replica{db: db, healthy: 1})
+	}
+	go r.check()
+	return r
+}
+
+// pick returns the next healthy replica, nil if none is healthy
+func (r *replicas) pick() *replica {
+	if r == nil {
+		return nil
+	}
+	for range r.list {
+		n := atomic.AddUint32(&r.next, 1)
+		rep := r.list[int(n)%len(r.list)]
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			return rep
+		}
+	}
+	return nil
+}
+
+// check pings every replica periodically until close is called
+func (r *replicas) check() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			for _, rep := range r.list {
+				rep.ping(context.Background())
+			}
+		}
+	}
+}
+
+// ping replica and update its health status, returns true if healthy
+func (rep *replica) ping(ctx context.Context) bool {
+	// only for ping, timeout context 3 second
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := rep.db.PingContext(pingCtx); err != nil {
+		atomic.StoreInt32(&rep.healthy, 0)
+		return false
+	}
+	atomic.StoreInt32(&rep.healthy, 1)
+	return true
+}
+
+// close stops health check and closes every replica
+func (r *replicas) close() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		close(r.stop)
+		for _, rep := range r.list {
+			rep.db.Close()
+		}
+	})
+}
+
+// OnPrimary forces read query to run on the primary database, useful for
+// read-after-write consistency when replicas are configured
+func (q *SqlQuery) OnPrimary() *SqlQuery {
+	q.primary = true
+	return q
+}
+
+// queryContext runs read query on a healthy replica, or on the primary
+// if there is no replica, inside transaction or OnPrimary is used. When the
+// replica fails and does not respond to ping, it is marked unhealthy and
+// the query is retried on primary.
+func (q *SqlQuery) queryContext(ctx context.Context) (*sql.Rows, error) {
+	if !q.primary {
+		if rep := q.replicas.pick(); rep != nil {
+			rows, err := rep.db.QueryContext(ctx, q.query, q.args...)
+			if err == nil || ctx.Err() != nil || rep.ping(ctx) {
+				return rows, err
+			}
+		}
+	}
+
+	return q.primaryQueryContext(ctx)
+}
@@ -70,3 +70,21 @@ func (r *Request) Scheme() string {
 	}
 	return "http"
 }
+
+// WantsJson reports whether the client prefers json response: json is
+// accepted before html, or the request is ajax or json without Accept html
+func (r *Request) WantsJson() bool {
+	accept := strings.ToLower(r.instance.Header.Get("Accept"))
+	jsonAt := strings.Index(accept, "json")
+	htmlAt := strings.Index(accept, "html")
+	if jsonAt >= 0 && (htmlAt < 0 || jsonAt < htmlAt) {
+		return true
+	}
+	if htmlAt >= 0 {
+		return false
+	}
+	if r.instance.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(r.instance.Header.Get("Content-Type")), "json")
+}
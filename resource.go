@@ -27,6 +27,12 @@ type Resource struct {
 	// database sql.DB
 	Database *Database
 
+	// named databases from Driver.Databases, see WithDatabases
+	Databases map[string]*Database
+
+	// tenant of the request, see Config.Tenants
+	Tenant string
+
 	// session SCS
 	Session *Session
 
@@ -44,12 +50,13 @@ func createResource(rw http.ResponseWriter, r *http.Request, h *HtmlEngine) *Res
 		request: r,
 		writer:  rw,
 
-		Context: r.Context(),
-		Request: newRequest(r),
-		Writer:  newWriter(rw),
-		Cookie:  newCookie(rw, r),
-		Html:    newHtml(rw, h),
-		Json:    newJson(rw),
+		Context:   r.Context(),
+		Request:   newRequest(r),
+		Writer:    newWriter(rw),
+		Cookie:    newCookie(rw, r),
+		Html:      newHtml(rw, h),
+		Json:      newJson(rw),
+		Databases: map[string]*Database{},
 	}
 }
 
@@ -63,6 +70,13 @@ func (r *Resource) Get(key interface{}) interface{} {
 	return r.Context.Value(key)
 }
 
+// Canceled reports whether the request is timed out or the client is gone,
+// long handlers should check it between steps that don't use Context.
+// Response written after timeout is discarded.
+func (r *Resource) Canceled() bool {
+	return r.Context.Err() != nil
+}
+
 // Redirect redirects the request to a provided URL with status code.
 func (r *Resource) Redirect(code int, url string) error {
 	if code < 300 || code > 308 {
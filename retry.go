@@ -0,0 +1,170 @@
+package jeen
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RetryPolicy configures RetryTx, zero fields use the value of
+// DefaultRetryPolicy
+type RetryPolicy struct {
+	// maximum attempts including the first one
+	MaxAttempts int
+
+	// wait before the second attempt, multiplied by Multiplier after each
+	// attempt up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// use a random wait between half and the full backoff, so conflicting
+	// transactions do not retry at the same time
+	Jitter bool
+
+	// Retryable replaces the default error classification, see
+	// Database.IsRetryable
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy is used by RetryTx when policy is nil
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         true,
+}
+
+// RetryTx runs fn inside a transaction like Tx and runs it again in a new
+// transaction when it fails with a serialization failure or deadlock.
+// Waiting between attempts stops when the request context is done, then
+// the context error is returned. fn must not have side effects outside
+// the transaction since it can run more than once.
+//
+//	err := res.Database.RetryTx(nil, func(tx *jeen.Database) error {
+//	    ...
+//	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+//
+// It is not retried when a failed commit may leave the transaction open,
+// the connection is discarded then. Inside a transaction fn runs once in
+// a savepoint, the failure aborts the outer transaction so it is retried
+// by the outer RetryTx. Route level WithTransaction is never retried
+// because the response may be written.
+func (d *Database) RetryTx(policy *RetryPolicy, fn func(tx *Database) error, opts ...*sql.TxOptions) error {
+	if d.tx != nil {
+		return d.savepoint(fn)
+	}
+
+	p := DefaultRetryPolicy
+	if policy != nil {
+		p = policy.withDefaults()
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = d.IsRetryable
+	}
+
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.Tx(fn, opts...)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) || d.lazy.isBad() {
+			return err
+		}
+
+		wait := backoff
+		if p.Jitter {
+			wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-d.context.Done():
+			timer.Stop()
+			return d.context.Err()
+		case <-timer.C:
+		}
+
+		backoff = time.Duration(float64(backoff) * p.Multiplier)
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// withDefaults returns policy with zero fields from DefaultRetryPolicy
+func (p *RetryPolicy) withDefaults() RetryPolicy {
+	policy := *p
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	return policy
+}
+
+// IsRetryable returns true if err is a serialization failure or deadlock
+// of the database, the transaction can succeed when it runs again:
+//
+//	postgres    SQLSTATE 40001 and 40P01
+//	mysql       error 1213
+//	sql server  error 1205
+//	oracle      ORA-08177 and ORA-00060
+//
+// Errors are matched without importing the drivers, by the SQLState method
+// (pgx, pq) or the Number field (mysql, mssql).
+func (d *Database) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch d.bindtype {
+	case DOLLAR:
+		var state interface{ SQLState() string }
+		if errors.As(err, &state) {
+			code := state.SQLState()
+			return code == "40001" || code == "40P01"
+		}
+	case QUESTION:
+		return errorNumber(err) == 1213
+	case AT:
+		return errorNumber(err) == 1205
+	case NAMED:
+		msg := err.Error()
+		return strings.Contains(msg, "ORA-08177") || strings.Contains(msg, "ORA-00060")
+	}
+	return false
+}
+
+// errorNumber returns the Number field of driver error in the chain,
+// -1 if there is none
+func errorNumber(err error) int64 {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+
+		field := v.FieldByName("Number")
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return field.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(field.Uint())
+		}
+	}
+	return -1
+}
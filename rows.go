@@ -0,0 +1,162 @@
+package jeen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/georgysavva/scany/dbscan"
+)
+
+// Rows is a cursor over the query result, each row is scanned when needed
+// so large result does not have to fit in memory. Rows must be closed
+// after use so the connection can run other queries, see Each for a
+// shortcut.
+//
+//	rows, err := res.Database.Query(`SELECT * FROM users`).Rows()
+//	if err != nil {
+//		return
+//	}
+//	defer rows.Close()
+//
+//	for rows.Next() {
+//		var user User
+//		if err := rows.Scan(&user); err != nil {
+//			return
+//		}
+//	}
+//	err = rows.Err()
+type Rows struct {
+	// request context
+	context context.Context
+
+	// database/sql rows
+	rows *sql.Rows
+
+	// scanny row scanner
+	scanner *dbscan.RowScanner
+
+	// error that stopped Next
+	err error
+
+	// query and event for AfterQuery hook, run once when iteration ends
+	query *SqlQuery
+	event *QueryEvent
+	count int64
+	done  bool
+}
+
+// Rows execute the query and returns cursor over the result
+func (q *SqlQuery) Rows() (*Rows, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	ctx, event := q.beforeQuery()
+	rows, err := q.queryContext(ctx)
+	if err != nil {
+		q.afterQuery(ctx, event, -1, err)
+		return nil, err
+	}
+
+	return &Rows{
+		context: ctx,
+		rows:    rows,
+		scanner: q.scan.NewRowScanner(rows),
+		query:   q,
+		event:   event,
+	}, nil
+}
+
+// Each execute the query and call fn for every row, fn must be a
+// func(row *T) error where T is the struct, map or type to scan into.
+// Iteration stops at the first error returned by fn, and the rows are
+// always closed when Each returns.
+//
+//	err := res.Database.Query(`SELECT * FROM users`).Each(func(user *User) error {
+//		return csv.Write(user.Record())
+//	})
+func (q *SqlQuery) Each(fn interface{}) error {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 || fnType.NumOut() != 1 ||
+		fnType.In(0).Kind() != reflect.Ptr || fnType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		return errors.New("Each only accepts func(row *T) error")
+	}
+	rowType := fnType.In(0).Elem()
+
+	rows, err := q.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := reflect.New(rowType)
+		if err := rows.Scan(row.Interface()); err != nil {
+			return err
+		}
+		if out := fnValue.Call([]reflect.Value{row})[0]; !out.IsNil() {
+			return out.Interface().(error)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Next prepares the next row for Scan, it returns false when there is no
+// more row, an error occurred or the request context is done.
+// Rows is closed automatically when Next returns false.
+func (r *Rows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if err := r.context.Err(); err != nil {
+		r.err = err
+		r.Close()
+		return false
+	}
+	if !r.rows.Next() {
+		r.finish()
+		return false
+	}
+	r.count++
+	return true
+}
+
+// finish runs AfterQuery hook once
+func (r *Rows) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.query.afterQuery(r.context, r.event, r.count, r.Err())
+}
+
+// Scan copies the current row into dest, dest can be a pointer to struct,
+// map or primitive type like in Result and Row
+func (r *Rows) Scan(dest interface{}) error {
+	return r.scanner.Scan(dest)
+}
+
+// Columns returns the column names of the result
+func (r *Rows) Columns() ([]string, error) {
+	return r.rows.Columns()
+}
+
+// Err returns the error encountered during iteration, if any
+func (r *Rows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+// Close closes the rows so the connection can run other queries, it is
+// safe to call Close more than once
+func (r *Rows) Close() error {
+	err := r.rows.Close()
+	r.finish()
+	return err
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,10 +18,6 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-var database *sql.DB
-var bindtype int
-var session *scs.SessionManager
-
 type Router interface {
 	chi.Router
 }
@@ -30,18 +28,47 @@ var (
 )
 
 type Driver struct {
-	Database func() (db *sql.DB, drivername string)
+	Database  func() (db *sql.DB, drivername string)
+	Databases map[string]func() (db *sql.DB, drivername string)
+	// read replicas keyed by database name, the driver name is the same
+	// as the primary, see SqlQuery.OnPrimary
+	Replicas map[string]func() (dbs []*sql.DB)
 	Session  func() (store scs.Store)
 }
 type Default struct {
-	WithDatabase bool
-	WithTimeout  time.Duration
-	WithTemplate *Template
+	WithDatabase  bool
+	WithDatabases []string
+	WithPing      time.Duration
+	WithTimeout   time.Duration
+	WithTemplate  *Template
 }
 
 type Config struct {
 	Driver  *Driver
 	Default *Default
+
+	// Migrations run by InitServer for each named database,
+	// use DefaultDatabase for Driver.Database
+	Migrations map[string]Migrator
+
+	// QueryHooks observe every query of every database
+	QueryHooks []QueryHook
+
+	// StatementCache enables prepared statement cache, nil disables it
+	StatementCache *StatementCache
+
+	// Tenants routes the default database to the tenant of the request
+	Tenants *Tenants
+
+	// ErrorHandler responds errors of HandlerErrorFunc, default is
+	// DefaultErrorHandler
+	ErrorHandler ErrorHandler
+}
+
+// Migrator migrates the database schema, see package
+// github.com/fuadarradhi/jeen/migrate
+type Migrator interface {
+	Migrate(ctx context.Context, db *sql.DB, bindtype int) error
 }
 
 type Delims struct {
@@ -58,10 +85,35 @@ type Template struct {
 	Delims       *Delims
 }
 
+// driver state owned by a server, shared with every Group, Route
+// and Mount created from it
+type driver struct {
+	databases map[string]*pool
+	session   *scs.SessionManager
+
+	// guards tenantPools
+	mu sync.Mutex
+
+	// tenant routing and pools of Tenants.Database by tenant, tenant
+	// pools get the same hooks and statement cache as other databases
+	tenants           *Tenants
+	tenantPools       map[string]*pool
+	hooks             []QueryHook
+	stmtCache         *StatementCache
+	stmtCacheDisabled map[string]bool
+
+	// responds errors returned by handlers
+	errorHandler ErrorHandler
+}
+
 type Server struct {
 	router         Router
+	driver         *driver
 	timeoutHandler HandlerRouteFunc
 	withDatabase   bool
+	withDatabases  []string
+	withTx         *sql.TxOptions
+	withPing       time.Duration
 	withSession    bool
 	withTimeout    time.Duration
 	withTemplate   *HtmlEngine
@@ -81,6 +133,34 @@ func WithDatabase(usedb bool) Options {
 	}
 }
 
+// WithDatabases acquires a connection from each named database registered
+// in Driver.Databases, see Resource.Databases to use it.
+func WithDatabases(names ...string) Options {
+	return func(s *Server) {
+		s.withDatabases = names
+	}
+}
+
+// WithTransaction begins a transaction on the default database before the
+// handler runs and exposes it as Resource.Database. The transaction is
+// committed when the handler responds with 2xx/3xx and rolled back on
+// 4xx/5xx, panic or timeout. WithTransaction implies WithDatabase(true).
+func WithTransaction(isolation sql.IsolationLevel) Options {
+	return func(s *Server) {
+		s.withDatabase = true
+		s.withTx = &sql.TxOptions{Isolation: isolation}
+	}
+}
+
+// WithPing checks every connection with ping when it is acquired from the
+// pool, 0 disables the check (default). database/sql already retries bad
+// connections, so ping is only useful to fail fast on a dead database.
+func WithPing(timeout time.Duration) Options {
+	return func(s *Server) {
+		s.withPing = timeout
+	}
+}
+
 func WithTimeout(timeout time.Duration) Options {
 	return func(s *Server) {
 		s.withTimeout = timeout
@@ -102,9 +182,16 @@ func InitServer(cfg *Config) *Server {
 	defSess := false
 	defTimeout := 7 * time.Second
 	var defTemplate *HtmlEngine
+	var defDbs []string
+	var defPing time.Duration
+	drv := &driver{
+		databases: map[string]*pool{},
+	}
 
 	if cfg.Default != nil {
 		defDb = cfg.Default.WithDatabase
+		defDbs = cfg.Default.WithDatabases
+		defPing = cfg.Default.WithPing
 		defTimeout = cfg.Default.WithTimeout
 		if cfg.Default.WithTemplate != nil {
 			defTemplate = newTemplateEngine(cfg.Default.WithTemplate)
@@ -118,32 +205,27 @@ func InitServer(cfg *Config) *Server {
 
 	if cfg.Driver != nil {
 		if cfg.Driver.Database != nil {
-			var drivername string
-			database, drivername = cfg.Driver.Database()
-
-			defaultBinds := map[int][]string{
-				DOLLAR:   {"postgres", "pgx", "pq-timeouts", "cloudsqlpostgres", "ql", "nrpostgres", "cockroach"},
-				QUESTION: {"mysql", "sqlite3", "nrmysql", "nrsqlite3"},
-				NAMED:    {"oci8", "ora", "goracle", "godror"},
-				AT:       {"sqlserver"},
+			db, drivername := cfg.Driver.Database()
+			drv.databases[DefaultDatabase] = newPool(db, drivername)
+		}
+		for name, open := range cfg.Driver.Databases {
+			if _, ok := drv.databases[name]; ok {
+				log.Fatalf("Database '%s' already defined.", name)
 			}
-
-			for bind, drivers := range defaultBinds {
-				for _, driver := range drivers {
-					if driver == drivername {
-						bindtype = bind
-						break
-					}
-				}
-				if bindtype != 0 {
-					break
-				}
+			db, drivername := open()
+			drv.databases[name] = newPool(db, drivername)
+		}
+		for name, open := range cfg.Driver.Replicas {
+			p, ok := drv.databases[name]
+			if !ok {
+				log.Fatalf("Replicas '%s', but driver not defined.", name)
 			}
+			p.replicas = newReplicas(open())
 		}
 		if cfg.Driver.Session != nil {
 			defSess = true
-			session = scs.New()
-			session.Store = cfg.Driver.Session()
+			drv.session = scs.New()
+			drv.session.Store = cfg.Driver.Session()
 		}
 
 		if defDb && cfg.Driver.Database == nil {
@@ -151,16 +233,77 @@ func InitServer(cfg *Config) *Server {
 		}
 	}
 
+	for name, p := range drv.databases {
+		p.name = name
+		p.hooks = cfg.QueryHooks
+	}
+	drv.hooks = cfg.QueryHooks
+	drv.errorHandler = cfg.ErrorHandler
+
+	if cfg.StatementCache != nil {
+		drv.stmtCache = cfg.StatementCache
+		drv.stmtCacheDisabled = map[string]bool{}
+		for _, name := range cfg.StatementCache.Disabled {
+			if _, ok := drv.databases[name]; !ok {
+				log.Fatalf("StatementCache disabled '%s', but driver not defined.", name)
+			}
+			drv.stmtCacheDisabled[name] = true
+		}
+		for name, p := range drv.databases {
+			if !drv.stmtCacheDisabled[name] {
+				p.stmts = newStmtCache(p.db, cfg.StatementCache.Size)
+			}
+		}
+	}
+
+	if cfg.Tenants != nil {
+		if cfg.Tenants.Resolve == nil {
+			log.Fatal("Tenants without Resolve.")
+		}
+		if cfg.Tenants.Database == nil && cfg.Tenants.Schema == nil {
+			log.Fatal("Tenants without Database or Schema.")
+		}
+		if cfg.Tenants.Database == nil && drv.databases[DefaultDatabase] == nil {
+			log.Fatal("Tenants Schema, but driver not defined.")
+		}
+		drv.tenants = cfg.Tenants
+	}
+
+	for _, name := range defDbs {
+		if _, ok := drv.databases[name]; !ok {
+			log.Fatalf("WithDatabases '%s', but driver not defined.", name)
+		}
+	}
+
+	for name, migrator := range cfg.Migrations {
+		p, ok := drv.databases[name]
+		if !ok {
+			log.Fatalf("Migrations '%s', but driver not defined.", name)
+		}
+		if err := migrator.Migrate(context.Background(), p.db, p.bindtype); err != nil {
+			log.Fatalf("Migrations '%s' failed: %v", name, err)
+		}
+	}
+
+	if store, ok := sessionStore(drv); ok {
+		if err := store.init(drv); err != nil {
+			log.Fatalf("Session store failed: %v", err)
+		}
+	}
+
 	r.Use(middleware.RealIP)
 	// r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
 	return &Server{
-		router:       r,
-		withDatabase: defDb,
-		withSession:  defSess,
-		withTimeout:  defTimeout,
-		withTemplate: defTemplate,
+		router:        r,
+		driver:        drv,
+		withDatabase:  defDb,
+		withDatabases: defDbs,
+		withPing:      defPing,
+		withSession:   defSess,
+		withTimeout:   defTimeout,
+		withTemplate:  defTemplate,
 	}
 }
 
@@ -186,7 +329,11 @@ func mergeWithOldEngine(old, new *Template) *Template {
 func (s *Server) newHandler(router Router, opts ...Options) *Server {
 	serv := &Server{
 		router:         router,
+		driver:         s.driver,
 		withDatabase:   s.withDatabase,
+		withDatabases:  s.withDatabases,
+		withTx:         s.withTx,
+		withPing:       s.withPing,
 		withSession:    s.withSession,
 		withTimeout:    s.withTimeout,
 		withTemplate:   s.withTemplate,
@@ -201,10 +348,14 @@ func (s *Server) newHandler(router Router, opts ...Options) *Server {
 func (s *Server) httpHandler(rw http.ResponseWriter, r *http.Request, handler interface{}, opts ...Options) bool {
 
 	serv := &Server{
-		withDatabase: s.withDatabase,
-		withTimeout:  s.withTimeout,
-		withSession:  s.withSession,
-		withTemplate: s.withTemplate,
+		driver:        s.driver,
+		withDatabase:  s.withDatabase,
+		withDatabases: s.withDatabases,
+		withTx:        s.withTx,
+		withPing:      s.withPing,
+		withTimeout:   s.withTimeout,
+		withSession:   s.withSession,
+		withTemplate:  s.withTemplate,
 	}
 	for _, opt := range opts {
 		opt(serv)
@@ -215,10 +366,15 @@ func (s *Server) httpHandler(rw http.ResponseWriter, r *http.Request, handler in
 	defer cancel()
 	r = r.WithContext(reqContext)
 
-	res := createResource(rw, r, serv.withTemplate)
+	// handler writes to buffer, so the timeout response can replace it,
+	// status code decides commit or rollback
+	tw := newTimeoutWriter(rw)
+	defer tw.finish()
+
+	res := createResource(tw, r, serv.withTemplate)
 
 	if serv.withSession {
-		res.Session = getSession(res.Context, session)
+		res.Session = getSession(res.Context, serv.driver.session)
 	}
 
 	// allow timeout handler set in each route,
@@ -230,15 +386,54 @@ func (s *Server) httpHandler(rw http.ResponseWriter, r *http.Request, handler in
 		}
 	}
 
+	// connection is acquired on first use and returned to the pool
+	// when the handler finishes
 	if serv.withDatabase {
-		db, err := conn(res.Context, database)
+		db, err := serv.driver.tenantConn(res, serv.withPing)
 		if err != nil {
-			timeoutHandler(res)
+			serv.driver.handleError(res, err)
 			return false
 		}
 		defer db.Close()
 
 		res.Database = db
+		res.Databases[DefaultDatabase] = db
+	}
+
+	for _, name := range serv.withDatabases {
+		if _, ok := res.Databases[name]; ok {
+			continue
+		}
+		var db *Database
+		var err error
+		if name == DefaultDatabase {
+			db, err = serv.driver.tenantConn(res, serv.withPing)
+		} else {
+			db, err = serv.driver.conn(res.Context, name, serv.withPing)
+		}
+		if err != nil {
+			serv.driver.handleError(res, err)
+			return false
+		}
+		defer db.Close()
+
+		if name == DefaultDatabase {
+			res.Database = db
+		}
+		res.Databases[name] = db
+	}
+
+	var tx *Database
+	if serv.withTx != nil {
+		var err error
+		tx, err = res.Database.begin(serv.withTx)
+		if err != nil {
+			serv.driver.handleError(res, err)
+			return false
+		}
+
+		res.Database = tx
+		res.Databases[DefaultDatabase] = tx
 	}
 
 	// Use goroutines to make sure
@@ -251,29 +446,55 @@ func (s *Server) httpHandler(rw http.ResponseWriter, r *http.Request, handler in
 	//
 	// ... process 1 here
 	//
-	// select {
-	//  case <-r.Context().Done():
+	// if res.Canceled() {
 	//  return
-	//   defaults:
 	// }
 	//
 	// ... process 2 here
 	//
-	processSuccess := make(chan bool)
-	defer close(processSuccess)
+	// the handler may still run after timeout, its writes are discarded.
+	// buffered so the goroutine never blocks when nobody receives.
+	processSuccess := make(chan bool, 1)
+
+	// handler returned error, set before processSuccess is sent
+	failed := false
+
+	// panic inside goroutine is forwarded with its stack, so transaction
+	// can be rolled back and middleware.Recoverer can handle it
+	processPanic := make(chan interface{}, 1)
 
 	// the process is done in goroutine so that it can be canceled when
 	// requesting timeout
 	go func() {
-		if h, ok := handler.(HandlerRouteFunc); ok {
-			h(res)
+		defer func() {
+			if p := recover(); p != nil {
+				// net/http aborts the response silently on ErrAbortHandler
+				if p != http.ErrAbortHandler {
+					p = &PanicError{Value: p, Stack: debug.Stack()}
+				}
+				processPanic <- p
+			}
+		}()
+
+		if h, ok := handler.(HandlerErrorFunc); ok {
+			if err := h(res); err != nil {
+				// replace what the handler wrote, a streamed response
+				// can't be replaced so the error is only logged. The
+				// transaction is rolled back whatever the status is.
+				failed = true
+				if tw.reset() {
+					serv.driver.handleError(res, err)
+				} else {
+					log.Println(err)
+				}
+			}
 		} else if h, ok := handler.(HandlerMiddlewareFunc); ok {
 			if success := h(res); !success {
 				processSuccess <- false
 				return
 			}
 		} else {
-			log.Fatal("Only HandlerRouteFunc and HandlerMiddlewareFunc are allowed")
+			log.Fatal("Only HandlerErrorFunc and HandlerMiddlewareFunc are allowed")
 		}
 		processSuccess <- true
 	}()
@@ -282,12 +503,51 @@ func (s *Server) httpHandler(rw http.ResponseWriter, r *http.Request, handler in
 
 	// if request timeout show response busy.
 	case <-reqContext.Done():
-		timeoutHandler(res)
+		if tx != nil {
+			tx.rollback()
+		}
+		// the handler can't write anymore, respond with the original
+		// writer unless the response is already streamed
+		if tw.stop() {
+			timeout := createResource(rw, r, serv.withTemplate)
+			timeout.Session = res.Session
+			timeout.Tenant = res.Tenant
+			timeoutHandler(timeout)
+		}
 		return false
 
+	// rollback and panic again outside goroutine, the buffered response
+	// is discarded so middleware.Recoverer can respond
+	case p := <-processPanic:
+		if tx != nil {
+			tx.rollback()
+		}
+		tw.stop()
+		panic(p)
+
 	// if the process is successful, just return it.
 	// response is done by main apps.
 	case isSuccess := <-processSuccess:
+		if tx != nil {
+			if !failed && tw.Status() < http.StatusBadRequest {
+				// the response is not sent yet unless it is streamed,
+				// replace it so the client doesn't see a success
+				if err := tx.commit(); err != nil {
+					if !tw.reset() {
+						log.Println(err)
+						return false
+					}
+					serv.driver.handleError(res, &HttpError{
+						Status:  http.StatusInternalServerError,
+						Message: http.StatusText(http.StatusInternalServerError),
+						Err:     err,
+					})
+					return false
+				}
+			} else {
+				tx.rollback()
+			}
+		}
 		return isSuccess
 	}
 }
@@ -344,10 +604,11 @@ func (s *Server) Handle(pattern string, handler HandlerServerFunc, opts ...Optio
 }
 
 // HandleFunc adds the route `pattern` that matches any http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) HandleFunc(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) HandleFunc(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.HandleFunc(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
@@ -365,10 +626,11 @@ func (s *Server) Method(method string, pattern string, handler HandlerServerFunc
 }
 
 // MethodFunc adds the route `pattern` that matches `method` http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) MethodFunc(method string, pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) MethodFunc(method string, pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.MethodFunc(method, pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
@@ -380,101 +642,113 @@ func (s *Server) Timeout(handler HandlerRouteFunc, opts ...Options) *Server {
 	return s
 }
 
-// NotFound sets a custom jeen.HandlerRouteFunc for routing paths that could
-// not be found. The default 404 handler is `http.NotFound`.
-func (s *Server) NotFound(handler HandlerRouteFunc, opts ...Options) *Server {
+// NotFound sets a custom jeen.HandlerRouteFunc or jeen.HandlerErrorFunc for
+// routing paths that could not be found. The default 404 handler is `http.NotFound`.
+func (s *Server) NotFound(handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.NotFound(func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
-// MethodNotAllowed sets a custom jeen.HandlerRouteFunc for routing paths where the
-// method is unresolved. The default handler returns a 405 with an empty body.
-func (s *Server) MethodNotAllowed(handler HandlerRouteFunc, opts ...Options) *Server {
+// MethodNotAllowed sets a custom jeen.HandlerRouteFunc or jeen.HandlerErrorFunc for
+// routing paths where the method is unresolved. The default handler returns a
+// 405 with an empty body.
+func (s *Server) MethodNotAllowed(handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.MethodNotAllowed(func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Connect adds the route `pattern` that matches a CONNECT http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Connect(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Connect(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Connect(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Delete adds the route `pattern` that matches a DELETE http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Delete(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Delete(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Delete(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Get adds the route `pattern` that matches a GET http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Get(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Get(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Get(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Head adds the route `pattern` that matches a HEAD http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Head(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Head(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Head(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Options adds the route `pattern` that matches a OPTIONS http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Options(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Options(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Options(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Patch adds the route `pattern` that matches a PATCH http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Patch(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Patch(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Patch(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Post adds the route `pattern` that matches a POST http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Post(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Post(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Post(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Put adds the route `pattern` that matches a PUT http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Put(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Put(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Put(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
 
 // Trace adds the route `pattern` that matches a TRACE http method to
-// execute the `handler` jeen.HandlerRouteFunc.
-func (s *Server) Trace(pattern string, handler HandlerRouteFunc, opts ...Options) *Server {
+// execute the `handler` jeen.HandlerRouteFunc or jeen.HandlerErrorFunc.
+func (s *Server) Trace(pattern string, handler interface{}, opts ...Options) *Server {
+	h := routeHandler(handler)
 	s.router.Trace(pattern, func(rw http.ResponseWriter, r *http.Request) {
-		s.httpHandler(rw, r, handler, opts...)
+		s.httpHandler(rw, r, h, opts...)
 	})
 	return s
 }
@@ -512,12 +786,35 @@ func (s *Server) With(handler HandlerMiddlewareFunc, opts ...Options) {
 
 // Close server and all resource
 func (s *Server) Close() {
-	if database != nil {
-		database.Close()
+	if store, ok := sessionStore(s.driver); ok {
+		store.close()
+	}
+
+	s.driver.mu.Lock()
+	for _, p := range s.driver.tenantPools {
+		p.stmts.reset()
+		p.db.Close()
+	}
+	s.driver.mu.Unlock()
+
+	for _, p := range s.driver.databases {
+		p.stmts.reset()
+		p.replicas.close()
+		p.db.Close()
 	}
 	log.Println("Thank you, server has been stopped.")
 }
 
+// DB returns the pool of the named database, nil if it is not defined,
+// e.g. for packages that need *sql.DB such as migrate and pglisten
+func (s *Server) DB(database string) *sql.DB {
+	p, ok := s.driver.databases[database]
+	if !ok {
+		return nil
+	}
+	return p.db
+}
+
 // Handler expose http.Handler
 func (s *Server) Handler() http.Handler {
 	return s.router
@@ -531,7 +828,7 @@ func (s *Server) ListenAndServe(addr string) {
 	// use session only if declared
 	var handler http.Handler
 	if s.withSession {
-		handler = session.LoadAndSave(s.router)
+		handler = s.driver.session.LoadAndSave(s.router)
 	} else {
 		handler = s.router
 	}
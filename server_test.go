@@ -0,0 +1,100 @@
+package jeen
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerError(t *testing.T) {
+	serv := InitServer(&Config{})
+	serv.Get("/buffered", func(res *Resource) error {
+		res.Html.ResponseString(http.StatusOK, "a,b\n1,2\n")
+		return errors.New("failed")
+	})
+	serv.Get("/streamed", func(res *Resource) error {
+		res.Html.ResponseString(http.StatusOK, "a,b\n1,2\n")
+		res.Writer.Instance().(http.Flusher).Flush()
+		return errors.New("failed")
+	})
+	serv.Get("/typed", func(res *Resource) error {
+		return NewHttpError(http.StatusUnprocessableEntity, "invalid", Map{"name": "required"})
+	})
+
+	tests := []struct {
+		path   string
+		accept string
+		status int
+		body   string
+	}{
+		{"/buffered", "text/html", http.StatusInternalServerError, "<h1>Internal Server Error</h1>"},
+		{"/streamed", "text/html", http.StatusOK, "a,b\n1,2\n"},
+		{"/typed", "application/json", http.StatusUnprocessableEntity, `{"status":422,"message":"invalid","details":{"name":"required"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			serv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			body := rec.Body.String()
+			if tt.status == http.StatusOK && body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			if tt.status != http.StatusOK && !strings.Contains(body, tt.body) {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			if strings.Contains(body, "a,b") && strings.Contains(body, "<!DOCTYPE") {
+				t.Errorf("error page appended to response %q", body)
+			}
+		})
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	serv := InitServer(&Config{})
+
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"value", "boom"},
+		{"abort", http.ErrAbortHandler},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				p := recover()
+				if tt.value == http.ErrAbortHandler {
+					if p != http.ErrAbortHandler {
+						t.Errorf("panic = %v, want http.ErrAbortHandler", p)
+					}
+					return
+				}
+				e, ok := p.(*PanicError)
+				if !ok {
+					t.Fatalf("panic = %#v, want *PanicError", p)
+				}
+				if e.Value != tt.value {
+					t.Errorf("value = %v, want %v", e.Value, tt.value)
+				}
+				if !strings.Contains(string(e.Stack), "TestHandlerPanic") {
+					t.Errorf("stack has no handler frame:\n%s", e.Stack)
+				}
+			}()
+
+			serv.httpHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil),
+				routeHandler(func(res *Resource) {
+					panic(tt.value)
+				}))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package jeen
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
@@ -23,7 +24,7 @@ type sessionValue struct {
 func getSession(ctx context.Context, sess *scs.SessionManager) *Session {
 	return &Session{
 		context: ctx,
-		session: session,
+		session: sess,
 	}
 }
 
@@ -138,6 +139,15 @@ func (s *Session) Iterate(fn func(session *Session) error) error {
 	})
 }
 
+// IterateSessions is Session.Iterate outside a request, e.g. in a background
+// job. The session store must support iteration, such as DatabaseStore.
+func (s *Server) IterateSessions(ctx context.Context, fn func(session *Session) error) error {
+	if s.driver.session == nil {
+		return errors.New("session is not defined")
+	}
+	return getSession(ctx, s.driver.session).Iterate(fn)
+}
+
 // Deadline returns the 'absolute' expiry time for the session. Please note
 // that if you are using an idle timeout, it is possible that a session will
 // expire due to non-use before the returned deadline.
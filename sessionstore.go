@@ -0,0 +1,265 @@
+package jeen
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaults of DatabaseStore
+const (
+	defaultSessionTable   = "sessions"
+	defaultSessionCleanup = 5 * time.Minute
+)
+
+// DatabaseStore is a scs.Store that keeps sessions in a database of the
+// server, the table is created on InitServer and expired sessions are
+// deleted in background until Server.Close. It supports Session.Iterate
+// and Server.IterateSessions.
+//
+//	jeen.InitServer(&jeen.Config{
+//		Driver: &jeen.Driver{
+//			Database: ...,
+//			Session: func() scs.Store {
+//				return &jeen.DatabaseStore{}
+//			},
+//		},
+//	})
+//
+// Session queries don't run QueryHooks, so tokens and data are never logged.
+type DatabaseStore struct {
+	// table name, default "sessions"
+	Table string
+
+	// database of the server, default DefaultDatabase
+	Database string
+
+	// interval of deleting expired sessions, default 5 minutes,
+	// negative disables it
+	CleanupInterval time.Duration
+
+	pool *pool
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// sessionRow is a row of the session table
+type sessionRow struct {
+	Token string `jeen:"token"`
+	Data  []byte `jeen:"data"`
+}
+
+// sessionStore returns DatabaseStore of the server session, if any
+func sessionStore(drv *driver) (*DatabaseStore, bool) {
+	if drv.session == nil {
+		return nil, false
+	}
+	store, ok := drv.session.Store.(*DatabaseStore)
+	return store, ok
+}
+
+// init creates the table in the database of drv and starts the cleaner
+func (s *DatabaseStore) init(drv *driver) error {
+	if s.Table == "" {
+		s.Table = defaultSessionTable
+	}
+	if s.Database == "" {
+		s.Database = DefaultDatabase
+	}
+	if s.CleanupInterval == 0 {
+		s.CleanupInterval = defaultSessionCleanup
+	}
+	if !identifier.MatchString(s.Table) {
+		return fmt.Errorf(`invalid session table '%s'`, s.Table)
+	}
+
+	p, ok := drv.databases[s.Database]
+	if !ok {
+		return fmt.Errorf(`database '%s' is not defined`, s.Database)
+	}
+	s.pool = p
+
+	if err := s.createTable(context.Background()); err != nil {
+		return err
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.cleanup()
+	return nil
+}
+
+// database returns Database without hooks for one operation, reads go to
+// the primary so a session committed by the previous request is found even
+// when replicas lag
+func (s *DatabaseStore) database(ctx context.Context) *Database {
+	db := newDatabase(ctx, s.pool, 0)
+	db.hooks = nil
+	db.replicas = nil
+	return db
+}
+
+// createTable creates the session table if it does not exist
+func (s *DatabaseStore) createTable(ctx context.Context) error {
+	db := s.database(ctx)
+	defer db.Close()
+
+	if _, err := db.Query(`SELECT 1 FROM ` + s.Table + ` WHERE 1 = 0`).Maps(); err == nil {
+		return nil
+	}
+
+	token, data, expiry := "VARCHAR(64)", "BLOB", "BIGINT"
+	switch {
+	case db.bindtype == DOLLAR:
+		data = "BYTEA"
+	case db.bindtype == AT:
+		token, data = "NVARCHAR(64)", "VARBINARY(MAX)"
+	case db.bindtype == NAMED:
+		token, expiry = "VARCHAR2(64)", "NUMBER(19)"
+	case db.bindtype == QUESTION && !strings.Contains(db.drivername, "sqlite"):
+		data = "MEDIUMBLOB"
+	}
+
+	create := fmt.Sprintf(`CREATE TABLE %s (token %s PRIMARY KEY, data %s NOT NULL, expiry %s NOT NULL)`,
+		s.Table, token, data, expiry)
+	if _, err := db.Query(create).Exec(); err != nil {
+		// created by other process in the meantime
+		if _, err2 := db.Query(`SELECT 1 FROM ` + s.Table + ` WHERE 1 = 0`).Maps(); err2 == nil {
+			return nil
+		}
+		return err
+	}
+
+	_, err := db.Query(fmt.Sprintf(`CREATE INDEX %s_expiry_idx ON %s (expiry)`,
+		strings.ReplaceAll(s.Table, ".", "_"), s.Table)).Exec()
+	return err
+}
+
+// cleanup deletes expired sessions periodically until close
+func (s *DatabaseStore) cleanup() {
+	defer close(s.done)
+	if s.CleanupInterval < 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(s.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.deleteExpired(); err != nil {
+				log.Println("Session cleanup failed:", err)
+			}
+		}
+	}
+}
+
+// deleteExpired deletes every expired session
+func (s *DatabaseStore) deleteExpired() error {
+	db := s.database(context.Background())
+	defer db.Close()
+
+	_, err := db.Query(`DELETE FROM `+s.Table+` WHERE expiry <= :now`, Map{
+		"now": time.Now().UnixNano(),
+	}).Exec()
+	return err
+}
+
+// close stops the cleaner
+func (s *DatabaseStore) close() {
+	if s.stop == nil {
+		return
+	}
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// Find returns data of unexpired session token
+func (s *DatabaseStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// FindCtx is Find with context
+func (s *DatabaseStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	db := s.database(ctx)
+	defer db.Close()
+
+	var rows []sessionRow
+	err := db.Query(`SELECT token, data FROM `+s.Table+` WHERE token = :token AND expiry > :now`, Map{
+		"token": token,
+		"now":   time.Now().UnixNano(),
+	}).Result(&rows)
+	if err != nil || len(rows) == 0 {
+		return nil, false, err
+	}
+	return rows[0].Data, true, nil
+}
+
+// Commit adds or replaces session token with data and expiry
+func (s *DatabaseStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx is Commit with context
+func (s *DatabaseStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	db := s.database(ctx)
+	defer db.Close()
+
+	_, err := db.Upsert(s.Table, []Map{{
+		"token":  token,
+		"data":   b,
+		"expiry": expiry.UnixNano(),
+	}}, "token")
+	return err
+}
+
+// Delete removes session token
+func (s *DatabaseStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx is Delete with context
+func (s *DatabaseStore) DeleteCtx(ctx context.Context, token string) error {
+	db := s.database(ctx)
+	defer db.Close()
+
+	_, err := db.Query(`DELETE FROM `+s.Table+` WHERE token = :token`, Map{
+		"token": token,
+	}).Exec()
+	return err
+}
+
+// All returns data of every unexpired session by token
+func (s *DatabaseStore) All() (map[string][]byte, error) {
+	return s.AllCtx(context.Background())
+}
+
+// AllCtx is All with context
+func (s *DatabaseStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	db := s.database(ctx)
+	defer db.Close()
+
+	var rows []sessionRow
+	err := db.Query(`SELECT token, data FROM `+s.Table+` WHERE expiry > :now`, Map{
+		"now": time.Now().UnixNano(),
+	}).Result(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string][]byte, len(rows))
+	for _, row := range rows {
+		sessions[row.Token] = row.Data
+	}
+	return sessions, nil
+}
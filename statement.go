@@ -0,0 +1,328 @@
+package jeen
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// default size of StatementCache
+const defaultStatementCacheSize = 256
+
+// StatementCache enables prepared statement cache of each database, set it
+// in Config.StatementCache. Statements are prepared on the pool and kept
+// in a LRU keyed by the built query, database/sql prepares them again on
+// each connection when needed.
+//
+// The cache is only used inside a transaction (Server.WithTx or
+// Database.Tx), where the statement runs on the transaction connection.
+// Outside a transaction queries run on the request connection without the
+// cache, since a pool statement may run on any connection of the pool and
+// break queries that depend on the session, e.g. SELECT set_config(...),
+// pg_advisory_lock, GET_LOCK, lastval(), LAST_INSERT_ID() or temporary
+// tables.
+//
+// Only SELECT and DML statements are cached, others such as SET, USE or
+// CREATE TEMPORARY TABLE run without it.
+type StatementCache struct {
+	// maximum statements of each database, default 256
+	Size int
+
+	// databases without cache, e.g. behind PgBouncer in transaction mode
+	// where prepared statements are not supported
+	Disabled []string
+}
+
+// StatementStats are the metrics of the prepared statement cache
+type StatementStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int   `json:"size"`
+}
+
+// HitRate returns hits of all lookups between 0 and 1
+func (s StatementStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// stmtCache is a bounded LRU of statements prepared on db
+type stmtCache struct {
+	db   *sql.DB
+	size int
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	stats StatementStats
+}
+
+// cachedStmt is a statement in the cache, it is closed when it is
+// evicted and no query is using it
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// create statement cache of db, size 0 is the default size
+func newStmtCache(db *sql.DB, size int) *stmtCache {
+	if size <= 0 {
+		size = defaultStatementCacheSize
+	}
+	return &stmtCache{
+		db:    db,
+		size:  size,
+		lru:   list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// get returns the statement of query, preparing it on a miss,
+// release must be called after use
+func (c *stmtCache) get(ctx context.Context, query string) (*cachedStmt, error) {
+	c.mu.Lock()
+	if el, ok := c.items[query]; ok {
+		c.lru.MoveToFront(el)
+		entry := el.Value.(*cachedStmt)
+		entry.refs++
+		c.stats.Hits++
+		c.mu.Unlock()
+		return entry, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// prepare without lock, a concurrent miss of the same query may
+	// prepare it twice and only one is kept
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[query]; ok {
+		stmt.Close()
+		entry := el.Value.(*cachedStmt)
+		entry.refs++
+		return entry, nil
+	}
+
+	entry := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.items[query] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	return entry, nil
+}
+
+// release statement returned by get
+func (c *stmtCache) release(entry *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// evict statement of query, e.g. when it is no longer valid
+func (c *stmtCache) evict(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[query]; ok {
+		c.remove(el)
+	}
+}
+
+// reset evicts every statement
+func (c *stmtCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove element from cache, closing it if unused, c.mu must be held
+func (c *stmtCache) remove(el *list.Element) {
+	entry := el.Value.(*cachedStmt)
+	c.lru.Remove(el)
+	delete(c.items, entry.query)
+	c.stats.Evictions++
+
+	entry.evicted = true
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// snapshot returns current metrics
+func (c *stmtCache) snapshot() StatementStats {
+	if c == nil {
+		return StatementStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// StatementStats returns metrics of the prepared statement cache of the
+// named database, zero if the cache is disabled
+func (s *Server) StatementStats(database string) StatementStats {
+	p, ok := s.driver.databases[database]
+	if !ok {
+		return StatementStats{}
+	}
+	return p.stmts.snapshot()
+}
+
+// ResetStatements closes every cached prepared statement of the database,
+// e.g. after schema changes that invalidate them
+func (d *Database) ResetStatements() {
+	d.stmts.reset()
+}
+
+// Unprepared runs the query without the prepared statement cache
+func (q *SqlQuery) Unprepared() *SqlQuery {
+	q.unprepared = true
+	return q
+}
+
+// prepared returns cached statement of the query for the transaction, nil
+// if the cache is not used
+func (q *SqlQuery) prepared(ctx context.Context) (*sql.Stmt, func(), error) {
+	cache := q.db.stmts
+	if cache == nil || q.db.tx == nil || q.unprepared || !cacheable(q.query) {
+		return nil, nil, nil
+	}
+
+	entry, err := cache.get(ctx, q.query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// reuses the statement if it is prepared on the transaction connection,
+	// closed with the transaction
+	stmt := q.db.tx.StmtContext(ctx, entry.stmt)
+	return stmt, func() { cache.release(entry) }, nil
+}
+
+// cacheable returns true if the first keyword of query is SELECT or DML,
+// other statements may change the session of the connection
+func cacheable(query string) bool {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(query, "--"):
+			i := strings.IndexByte(query, '\n')
+			if i < 0 {
+				return false
+			}
+			query = query[i+1:]
+		case strings.HasPrefix(query, "/*"):
+			i := strings.Index(query, "*/")
+			if i < 0 {
+				return false
+			}
+			query = query[i+2:]
+		default:
+			end := strings.IndexFunc(query, func(char rune) bool {
+				return !isIdentRune(char)
+			})
+			if end < 0 {
+				end = len(query)
+			}
+			switch strings.ToUpper(query[:end]) {
+			case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "MERGE", "VALUES", "REPLACE":
+				return true
+			}
+			return false
+		}
+	}
+}
+
+// primaryQueryContext runs read query on the primary, with cached statement
+// if enabled
+func (q *SqlQuery) primaryQueryContext(ctx context.Context) (*sql.Rows, error) {
+	stmt, release, err := q.prepared(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stmt != nil {
+		rows, err := stmt.QueryContext(ctx, q.args...)
+		release()
+		q.evictStale(err)
+		return rows, err
+	}
+
+	conn, err := q.db.executor()
+	if err != nil {
+		return nil, err
+	}
+	return conn.QueryContext(ctx, q.query, q.args...)
+}
+
+// execContext executes query on the primary, with cached statement if
+// enabled
+func (q *SqlQuery) execContext(ctx context.Context) (sql.Result, error) {
+	stmt, release, err := q.prepared(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stmt != nil {
+		result, err := stmt.ExecContext(ctx, q.args...)
+		release()
+		q.evictStale(err)
+		return result, err
+	}
+
+	conn, err := q.db.executor()
+	if err != nil {
+		return nil, err
+	}
+	return conn.ExecContext(ctx, q.query, q.args...)
+}
+
+// evictStale evicts the statement when err shows that it is no longer
+// valid on the server (connection reset, schema change). The query is not
+// run again since the transaction may be aborted.
+func (q *SqlQuery) evictStale(err error) {
+	if err == nil {
+		return
+	}
+
+	stale := errors.Is(err, sqldriver.ErrBadConn)
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		// cached plan must not change result type, prepared statement
+		// does not exist
+		code := state.SQLState()
+		stale = stale || code == "0A000" || code == "26000"
+	}
+	// mysql: prepared statement needs to be re-prepared
+	stale = stale || errorNumber(err) == 1615
+
+	if stale {
+		q.db.stmts.evict(q.query)
+	}
+}
@@ -0,0 +1,31 @@
+package jeen
+
+import "testing"
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`SELECT * FROM u`, true},
+		{"  select 1", true},
+		{"-- comment\n/* block */ (SELECT 1) UNION (SELECT 2)", true},
+		{`WITH x AS (SELECT 1) SELECT * FROM x`, true},
+		{`INSERT INTO u VALUES (1)`, true},
+		{`update u set a = 1`, true},
+		{`DELETE FROM u`, true},
+		{`SET TIME ZONE 'UTC'`, false},
+		{`SET search_path TO tenant`, false},
+		{"USE `tenant`", false},
+		{`CREATE TEMPORARY TABLE t (id int)`, false},
+		{`SELECTX 1`, false},
+		{`-- only comment`, false},
+		{``, false},
+	}
+
+	for _, tt := range tests {
+		if got := cacheable(tt.query); got != tt.want {
+			t.Errorf("cacheable(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
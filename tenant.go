@@ -0,0 +1,224 @@
+package jeen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrUnknownTenant is returned by Tenants functions when the tenant does
+// not exist, the request is answered with 404
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// TenantResolver returns the tenant of the request, empty if the request
+// has no tenant and uses the default database as is
+type TenantResolver func(res *Resource) (string, error)
+
+// Tenants routes the default database of every request to the tenant,
+// set it in Config.Tenants. The tenant is available as Resource.Tenant.
+//
+//	jeen.InitServer(&jeen.Config{
+//		Tenants: &jeen.Tenants{
+//			Resolve: jeen.TenantHost(),
+//			Schema: func(tenant string) (string, error) {
+//				return "tenant_" + tenant, nil
+//			},
+//		},
+//	})
+type Tenants struct {
+	Resolve TenantResolver
+
+	// Database returns the pool of tenant, for a database per tenant.
+	// It is called once per tenant, the pool is kept until Server.Close.
+	Database func(tenant string) (db *sql.DB, drivername string, err error)
+
+	// Schema returns the schema of tenant that is set on the connection
+	// when it is acquired and reset before it is returned to the pool:
+	// search_path for postgres (comma separated schemas are allowed),
+	// USE for mysql and sql server, CURRENT_SCHEMA for oracle. Replicas
+	// and the statement cache are not used since they run on other
+	// connections.
+	Schema func(tenant string) (string, error)
+}
+
+// TenantHost resolves tenant from the first label of the host name, e.g.
+// acme of acme.example.com, hosts without subdomain have no tenant
+func TenantHost() TenantResolver {
+	return func(res *Resource) (string, error) {
+		host := res.request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		labels := strings.Split(host, ".")
+		if len(labels) < 3 || net.ParseIP(host) != nil {
+			return "", nil
+		}
+		return strings.ToLower(labels[0]), nil
+	}
+}
+
+// TenantHeader resolves tenant from request header, e.g. X-Tenant-ID
+func TenantHeader(name string) TenantResolver {
+	return func(res *Resource) (string, error) {
+		return res.request.Header.Get(name), nil
+	}
+}
+
+// TenantURLParam resolves tenant from url parameter of the route pattern,
+// e.g. tenant of /{tenant}/orders
+func TenantURLParam(name string) TenantResolver {
+	return func(res *Resource) (string, error) {
+		return res.Request.URLParam(name), nil
+	}
+}
+
+// TenantSession resolves tenant from string session value
+func TenantSession(key string) TenantResolver {
+	return func(res *Resource) (string, error) {
+		if res.Session == nil {
+			return "", nil
+		}
+		return res.Session.Get(key).String(), nil
+	}
+}
+
+// tenantConn returns Database of the default database routed to the
+// tenant of the request
+func (d *driver) tenantConn(res *Resource, ping time.Duration) (*Database, error) {
+	if d.tenants == nil {
+		return d.conn(res.Context, DefaultDatabase, ping)
+	}
+
+	tenant, err := d.tenants.Resolve(res)
+	if err != nil {
+		return nil, err
+	}
+	res.Tenant = tenant
+	if tenant == "" {
+		return d.conn(res.Context, DefaultDatabase, ping)
+	}
+
+	p := d.databases[DefaultDatabase]
+	if d.tenants.Database != nil {
+		if p, err = d.tenantPool(tenant); err != nil {
+			return nil, err
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf(`database '%s' is not defined`, DefaultDatabase)
+	}
+
+	db := newDatabase(res.Context, p, ping)
+	if d.tenants.Schema != nil {
+		schema, err := d.tenants.Schema(tenant)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.useSchema(schema); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// tenantPool returns pool of the tenant, opened on first use
+func (d *driver) tenantPool(tenant string) (*pool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if p, ok := d.tenantPools[tenant]; ok {
+		return p, nil
+	}
+
+	db, drivername, err := d.tenants.Database(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newPool(db, drivername)
+	p.name = DefaultDatabase
+	p.hooks = d.hooks
+	if d.stmtCache != nil && !d.stmtCacheDisabled[DefaultDatabase] {
+		p.stmts = newStmtCache(db, d.stmtCache.Size)
+	}
+
+	if d.tenantPools == nil {
+		d.tenantPools = map[string]*pool{}
+	}
+	d.tenantPools[tenant] = p
+	return p, nil
+}
+
+// useSchema sets schema on the connection when it is acquired and
+// restores the previous schema before it is returned to the pool
+func (d *Database) useSchema(schema string) error {
+	names := strings.Split(schema, ",")
+	if len(names) > 1 && d.bindtype != DOLLAR {
+		return fmt.Errorf(`invalid schema '%s'`, schema)
+	}
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		if !identifier.MatchString(names[i]) {
+			return fmt.Errorf(`invalid schema '%s'`, schema)
+		}
+	}
+
+	var current string
+	var use func(schema string) (string, []interface{})
+	switch {
+	case d.bindtype == DOLLAR:
+		current = `SELECT current_setting('search_path')`
+		use = func(schema string) (string, []interface{}) {
+			return `SELECT set_config('search_path', $1, false)`, []interface{}{schema}
+		}
+	case d.bindtype == QUESTION && !strings.Contains(d.drivername, "sqlite"):
+		current = `SELECT DATABASE()`
+		use = func(schema string) (string, []interface{}) {
+			return "USE `" + schema + "`", nil
+		}
+	case d.bindtype == AT:
+		current = `SELECT DB_NAME()`
+		use = func(schema string) (string, []interface{}) {
+			return "USE [" + schema + "]", nil
+		}
+	case d.bindtype == NAMED:
+		current = `SELECT SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') FROM DUAL`
+		use = func(schema string) (string, []interface{}) {
+			return `ALTER SESSION SET CURRENT_SCHEMA = ` + schema, nil
+		}
+	default:
+		return fmt.Errorf(`schema tenants are not supported by driver '%s'`, d.drivername)
+	}
+	schema = strings.Join(names, ", ")
+
+	// other connections do not have the schema
+	d.replicas = nil
+	d.stmts = nil
+
+	d.lazy.setup = func(ctx context.Context, conn *sql.Conn) (func(ctx context.Context) error, error) {
+		var previous sql.NullString
+		if err := conn.QueryRowContext(ctx, current).Scan(&previous); err != nil {
+			return nil, err
+		}
+
+		query, args := use(schema)
+		if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+			return nil, err
+		}
+
+		return func(ctx context.Context) error {
+			if !previous.Valid {
+				// the connection had no schema, it can't be restored
+				return errors.New("previous schema is unknown")
+			}
+			query, args := use(previous.String)
+			_, err := conn.ExecContext(ctx, query, args...)
+			return err
+		}, nil
+	}
+	return nil
+}
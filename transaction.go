@@ -0,0 +1,136 @@
+package jeen
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoConnection is returned when the connection is not available
+var ErrNoConnection = errors.New("database connection is not available")
+
+// Tx runs fn inside a transaction. The transaction is committed when fn
+// returns nil and rolled back when fn returns an error or panics, the panic
+// is re-raised after rollback.
+//
+// The tx passed to fn works like the Database itself, so Query, Result, Row
+// and Exec are executed inside the transaction.
+//
+//	err := res.Database.Tx(func(tx *jeen.Database) error {
+//	    _, err := tx.Query(`UPDATE account SET balance = :balance`, jeen.Map{
+//	        "balance": 10,
+//	    }).Exec()
+//	    return err
+//	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+//
+// Calling Tx on a tx creates a savepoint, so only the nested part is rolled
+// back on error. Options are ignored for nested calls.
+func (d *Database) Tx(fn func(tx *Database) error, opts ...*sql.TxOptions) (err error) {
+	if d.tx != nil {
+		return d.savepoint(fn)
+	}
+
+	var opt *sql.TxOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	tx, err := d.begin(opt)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.rollback()
+			return
+		}
+		err = tx.commit()
+	}()
+
+	return fn(tx)
+}
+
+// begin starts a transaction on the connection and returns a copy of
+// Database that executes every query inside it
+func (d *Database) begin(opt *sql.TxOptions) (*Database, error) {
+	conn, err := d.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.BeginTx(d.context, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	child := *d
+	child.tx = tx
+	child.depth = 0
+	return &child, nil
+}
+
+// commit the transaction started by begin. When it fails the connection is
+// discarded if the transaction may be left open: always for sqlite, for
+// other databases unless the error is a serialization failure or deadlock
+// that ends the transaction (see IsRetryable).
+func (d *Database) commit() error {
+	err := d.tx.Commit()
+	if err != nil && (strings.Contains(d.drivername, "sqlite") || !d.IsRetryable(err)) {
+		d.lazy.markBad()
+	}
+	return err
+}
+
+// rollback the transaction started by begin
+func (d *Database) rollback() error {
+	return d.tx.Rollback()
+}
+
+// savepoint runs fn inside a savepoint of the current transaction
+func (d *Database) savepoint(fn func(tx *Database) error) (err error) {
+	child := *d
+	child.depth = d.depth + 1
+
+	name := fmt.Sprintf("jeen_sp_%d", child.depth)
+
+	create, rollback, release := "SAVEPOINT "+name, "ROLLBACK TO SAVEPOINT "+name, "RELEASE SAVEPOINT "+name
+	switch d.bindtype {
+	// sql server uses SAVE TRANSACTION and has no release
+	case AT:
+		create, rollback, release = "SAVE TRANSACTION "+name, "ROLLBACK TRANSACTION "+name, ""
+	// oracle has no release, savepoint ends with the transaction
+	case NAMED:
+		release = ""
+	}
+
+	if _, err = d.tx.ExecContext(d.context, create); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			d.tx.ExecContext(d.context, rollback)
+			panic(p)
+		}
+		if err != nil {
+			d.tx.ExecContext(d.context, rollback)
+			return
+		}
+		if release != "" {
+			_, err = d.tx.ExecContext(d.context, release)
+		}
+	}()
+
+	return fn(&child)
+}
+
+// InTx returns true if Database is inside transaction
+func (d *Database) InTx() bool {
+	return d.tx != nil
+}
@@ -0,0 +1,72 @@
+package jeen
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"testing"
+)
+
+// commitError is returned by COMMIT of fakeDriver
+var commitError error
+
+type fakeDriver struct{}
+type fakeConn struct{}
+type fakeTx struct{}
+
+type stateError string
+
+func (e stateError) Error() string    { return "SQLSTATE " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+func (fakeDriver) Open(name string) (sqldriver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (sqldriver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (fakeConn) Close() error                 { return nil }
+func (fakeConn) Begin() (sqldriver.Tx, error) { return fakeTx{}, nil }
+func (fakeTx) Commit() error                  { return commitError }
+func (fakeTx) Rollback() error                { return nil }
+
+func init() {
+	sql.Register("jeenfake", fakeDriver{})
+}
+
+func TestCommitBadConn(t *testing.T) {
+	tests := []struct {
+		name       string
+		drivername string
+		err        error
+		bad        bool
+	}{
+		{"success", "pgx", nil, false},
+		{"serialization failure", "pgx", stateError("40001"), false},
+		{"deadlock", "pgx", stateError("40P01"), false},
+		{"constraint", "pgx", stateError("23505"), true},
+		{"sqlite", "sqlite3", errors.New("database is locked"), true},
+	}
+
+	db, err := sql.Open("jeenfake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commitError = tt.err
+			d := newDatabase(context.Background(), newPool(db, tt.drivername), 0)
+			defer d.Close()
+
+			err := d.Tx(func(tx *Database) error { return nil })
+			if err != tt.err {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+			if bad := d.lazy.isBad(); bad != tt.bad {
+				t.Errorf("bad = %v, want %v", bad, tt.bad)
+			}
+		})
+	}
+}
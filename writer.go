@@ -1,6 +1,13 @@
 package jeen
 
-import "net/http"
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
 
 type Writer struct {
 	writer http.ResponseWriter
@@ -15,3 +22,175 @@ func newWriter(rw http.ResponseWriter) *Writer {
 func (w *Writer) Instance() http.ResponseWriter {
 	return w.writer
 }
+
+// timeoutWriter buffers the response of a handler until it finishes, like
+// http.TimeoutHandler, so the timeout response is the only response when the
+// handler is too late. Flush sends the buffer and the response is streamed
+// from then on, a timeout only stops it. Writes after timeout return
+// http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+	sent     bool
+	hijacked bool
+}
+
+func newTimeoutWriter(rw http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		w: rw,
+		h: http.Header{},
+	}
+}
+
+// Header returns header of the buffered response
+func (w *timeoutWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.h
+}
+
+func (w *timeoutWriter) WriteHeader(statusCode int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.hijacked || w.status != 0 {
+		return
+	}
+	w.status = statusCode
+	if w.sent {
+		w.w.WriteHeader(statusCode)
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.sent {
+		return w.w.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// Flush sends the buffered response and any later write to the client
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.hijacked {
+		return
+	}
+	w.send()
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, e.g. for WebSocket
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	hj, ok := w.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijack")
+	}
+	if w.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// send writes header and buffer to the client, w.mu must be held
+func (w *timeoutWriter) send() {
+	if w.sent {
+		return
+	}
+	w.sent = true
+
+	dst := w.w.Header()
+	for k, v := range w.h {
+		dst[k] = v
+	}
+	if w.status == 0 {
+		// nothing written, keep the header open for later writes
+		if w.buf.Len() == 0 {
+			w.sent = false
+			return
+		}
+		w.status = http.StatusOK
+	}
+	w.w.WriteHeader(w.status)
+	w.w.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// reset discards the buffered header, status and body so another response
+// can be written, false when the response is already sent
+func (w *timeoutWriter) reset() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.hijacked || w.sent {
+		return false
+	}
+	w.h = http.Header{}
+	w.status = 0
+	w.buf.Reset()
+	return true
+}
+
+// finish sends the response of a handler that returned in time
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.hijacked {
+		return
+	}
+	w.send()
+}
+
+// stop discards the buffer and rejects later writes, e.g. on timeout, it
+// returns false when the response is already sent so no other response can
+// be written
+func (w *timeoutWriter) stop() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return false
+	}
+	w.timedOut = true
+	w.buf.Reset()
+	return !w.sent && !w.hijacked
+}
+
+// Status returns the written status code, http.StatusOK if nothing written
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,149 @@
+package jeen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTimeoutWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		run    func(t *testing.T, w *timeoutWriter, rec *httptest.ResponseRecorder)
+		status int
+		body   string
+		header string
+	}{
+		{
+			name: "buffered then finish",
+			run: func(t *testing.T, w *timeoutWriter, rec *httptest.ResponseRecorder) {
+				w.Header().Set("X-Test", "a")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("hello"))
+				if rec.Body.Len() > 0 || rec.Header().Get("X-Test") != "" {
+					t.Error("response sent before finish")
+				}
+				w.finish()
+			},
+			status: http.StatusCreated,
+			body:   "hello",
+			header: "a",
+		},
+		{
+			name: "write after stop",
+			run: func(t *testing.T, w *timeoutWriter, rec *httptest.ResponseRecorder) {
+				w.Write([]byte("a"))
+				if !w.stop() {
+					t.Error("stop = false, want true")
+				}
+				if _, err := w.Write([]byte("b")); err != http.ErrHandlerTimeout {
+					t.Errorf("write error = %v, want %v", err, http.ErrHandlerTimeout)
+				}
+				if w.reset() {
+					t.Error("reset = true, want false")
+				}
+				w.finish()
+			},
+			status: http.StatusOK,
+			body:   "",
+		},
+		{
+			name: "reset before flush",
+			run: func(t *testing.T, w *timeoutWriter, rec *httptest.ResponseRecorder) {
+				w.Header().Set("X-Test", "a")
+				w.Write([]byte("a"))
+				if !w.reset() {
+					t.Error("reset = false, want true")
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("error"))
+				w.finish()
+			},
+			status: http.StatusInternalServerError,
+			body:   "error",
+		},
+		{
+			name: "reset after flush",
+			run: func(t *testing.T, w *timeoutWriter, rec *httptest.ResponseRecorder) {
+				w.Header().Set("X-Test", "a")
+				w.Write([]byte("a"))
+				w.Flush()
+				if !rec.Flushed || rec.Body.String() != "a" {
+					t.Errorf("flushed = %v, body = %q", rec.Flushed, rec.Body.String())
+				}
+				if w.reset() {
+					t.Error("reset = true, want false")
+				}
+				w.Write([]byte("b"))
+				if w.stop() {
+					t.Error("stop = true, want false")
+				}
+				w.finish()
+			},
+			status: http.StatusOK,
+			body:   "ab",
+			header: "a",
+		},
+		{
+			name: "header only",
+			run: func(t *testing.T, w *timeoutWriter, rec *httptest.ResponseRecorder) {
+				w.Header().Set("X-Test", "a")
+				w.finish()
+
+				// the next handler writes to the original writer
+				rec.Write([]byte("next"))
+			},
+			status: http.StatusOK,
+			body:   "next",
+			header: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.run(t, newTimeoutWriter(rec), rec)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.body)
+			}
+			if header := rec.Header().Get("X-Test"); header != tt.header {
+				t.Errorf("header = %q, want %q", header, tt.header)
+			}
+		})
+	}
+}
+
+func TestTimeoutWriterStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *timeoutWriter)
+		want  int
+	}{
+		{"nothing written", func(w *timeoutWriter) {}, http.StatusOK},
+		{"header only", func(w *timeoutWriter) { w.Header().Set("X-Test", "a") }, http.StatusOK},
+		{"write", func(w *timeoutWriter) { w.Write([]byte("a")) }, http.StatusOK},
+		{"write header", func(w *timeoutWriter) { w.WriteHeader(http.StatusNotFound) }, http.StatusNotFound},
+		{"write header after write", func(w *timeoutWriter) {
+			w.Write([]byte("a"))
+			w.WriteHeader(http.StatusNotFound)
+		}, http.StatusOK},
+		{"reset", func(w *timeoutWriter) {
+			w.WriteHeader(http.StatusNotFound)
+			w.reset()
+		}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTimeoutWriter(httptest.NewRecorder())
+			tt.write(w)
+			if got := w.Status(); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}